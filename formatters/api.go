@@ -23,7 +23,8 @@ var (
 	// Default HTML formatter outputs self-contained HTML.
 	htmlFull = Register("html", html.New(html.Standalone(true), html.WithClasses(true))) // nolint
 	SVG      = Register("svg", svg.New(svg.EmbedFont("Liberation Mono", svg.FontLiberationMono, svg.WOFF)))
-	twFull   = Register("tailwind", tailwind.New())
+	// Tailwind formatter with the defaults of tailwind.New.
+	twFull = Register("tailwind", tailwind.New())
 )
 
 // Fallback formatter.
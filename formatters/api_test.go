@@ -0,0 +1,22 @@
+package formatters
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/alecthomas/assert/v2"
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/formatters/tailwind"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestGetTailwind(t *testing.T) {
+	formatter, ok := Get("tailwind").(*tailwind.Formatter)
+	assert.True(t, ok)
+	assert.SliceContains(t, Names(), "tailwind")
+
+	out := strings.Builder{}
+	err := formatter.Format(&out, styles.Get("github"), chroma.Literator(chroma.Token{Type: chroma.Keyword, Value: "func"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `<pre class="bg-[#f7f7f7]"><code><span class="flex"><span class="grow"><span class="text-[#cf222e]">func</span></span></span></code></pre>`, out.String())
+}
@@ -0,0 +1,168 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestCacheStats(t *testing.T) {
+	formatter := New()
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	formatter.classCache.get(light, dark)
+	formatter.classCache.get(light, dark)
+	formatter.classCache.get(dark, nil)
+	formatter.classCache.get(light, dark)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2}, formatter.CacheStats())
+
+	for i := range classCacheLimit {
+		style := chroma.MustNewStyle(fmt.Sprintf("style-%d", i), chroma.StyleEntries{chroma.Keyword: "#000000"})
+		formatter.classCache.get(style, nil)
+	}
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2 + classCacheLimit, Evictions: 2}, formatter.CacheStats())
+}
+
+func TestClearCache(t *testing.T) {
+	formatter := New()
+	style := styles.Get("github")
+	render := func() {
+		it, err := lexers.Get("go").Tokenise(nil, "package main\n")
+		assert.NoError(t, err)
+		assert.NoError(t, formatter.Format(io.Discard, style, it))
+	}
+	render()
+	render()
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, formatter.CacheStats())
+
+	formatter.ClearCache()
+	assert.Equal(t, 0, len(formatter.classCache.cache))
+	render()
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2}, formatter.CacheStats())
+}
+
+func TestCacheByStyleName(t *testing.T) {
+	build := func(keyword string) *chroma.Style {
+		style, err := styles.Get("github").Builder().Add(chroma.Keyword, keyword).Build()
+		assert.NoError(t, err)
+		return style
+	}
+	a, b, other := build("#111111"), build("#111111"), build("#222222")
+
+	formatter := New()
+	formatter.classCache.get(a, nil)
+	formatter.classCache.get(b, nil)
+	assert.Equal(t, CacheStats{Misses: 2}, formatter.CacheStats())
+
+	formatter = New(CacheByStyleName(true))
+	formatter.classCache.get(a, nil)
+	formatter.classCache.get(b, nil)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, formatter.CacheStats())
+	classes := formatter.classCache.get(other, nil)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2}, formatter.CacheStats())
+	assert.Contains(t, classes[chroma.Keyword], "text-[#222222]")
+}
+
+func TestCacheMemoryBudget(t *testing.T) {
+	light := styles.Get("github")
+	size := classMapSize(New().classes(light, light))
+
+	formatter := New(CacheMemoryBudget(size * 2))
+	for _, name := range []string{"github", "github-dark", "monokai"} {
+		formatter.classCache.get(styles.Get(name), nil)
+	}
+	stats := formatter.CacheStats()
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.True(t, stats.Evictions >= 1)
+	assert.True(t, formatter.classCache.size <= size*2 || len(formatter.classCache.cache) == 1)
+	assert.Equal(t, "monokai", formatter.classCache.cache[len(formatter.classCache.cache)-1].light.Name)
+
+	formatter = New(CacheMemoryBudget(1))
+	formatter.classCache.get(light, nil)
+	assert.Equal(t, 1, len(formatter.classCache.cache))
+
+	formatter.ClearCache()
+	assert.Equal(t, 0, formatter.classCache.size)
+}
+
+func TestClassCacheSize(t *testing.T) {
+	newStyles := func(n int) []*chroma.Style {
+		out := make([]*chroma.Style, n)
+		for i := range out {
+			out[i] = chroma.MustNewStyle(fmt.Sprintf("style-%d", i), chroma.StyleEntries{chroma.Keyword: "#000000"})
+		}
+		return out
+	}
+
+	formatter := New(ClassCacheSize(2))
+	for _, style := range newStyles(3) {
+		formatter.classCache.get(style, nil)
+	}
+	assert.Equal(t, 2, len(formatter.classCache.cache))
+	assert.Equal(t, CacheStats{Misses: 3, Evictions: 1}, formatter.CacheStats())
+
+	formatter = New(ClassCacheSize(0))
+	many := newStyles(classCacheLimit * 2)
+	for _, style := range many {
+		formatter.classCache.get(style, nil)
+	}
+	formatter.classCache.get(many[0], nil)
+	assert.Equal(t, len(many), len(formatter.classCache.cache))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: uint64(len(many))}, formatter.CacheStats())
+
+	// Concurrent use of a small cache.
+	formatter = New(ClassCacheSize(3))
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				formatter.classCache.get(many[(i+j)%5], nil)
+			}
+		}()
+	}
+	wg.Wait()
+	stats := formatter.CacheStats()
+	assert.Equal(t, uint64(8*50), stats.Hits+stats.Misses)
+	assert.Equal(t, 3, len(formatter.classCache.cache))
+}
+
+func TestFormatWithPrefix(t *testing.T) {
+	formatter := New()
+	style := styles.Get("github")
+	render := func(prefix string) string {
+		it, err := lexers.Get("go").Tokenise(nil, "package main\n")
+		assert.NoError(t, err)
+		var buf strings.Builder
+		assert.NoError(t, formatter.FormatWithPrefix(&buf, prefix, style, it))
+		return buf.String()
+	}
+	a := render("a-")
+	b := render("b-")
+	assert.Contains(t, a, `<span class="a-text-[#cf222e]">package</span>`)
+	assert.Contains(t, b, `<span class="b-text-[#cf222e]">package</span>`)
+	assert.Equal(t, a, render("a-"))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2}, formatter.CacheStats())
+
+	assert.Equal(t, format(t, "package main\n"), render(""))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3}, formatter.CacheStats())
+
+	// Every prefix is held by the one cache, within its limits.
+	formatter = New(ClassCacheSize(2))
+	for i := range 10 {
+		render(fmt.Sprintf("p%d-", i))
+	}
+	assert.Equal(t, 2, len(formatter.classCache.cache))
+	assert.Equal(t, "p9-", formatter.classCache.cache[1].prefix)
+	formatter.ClearCache()
+	assert.Equal(t, 0, len(formatter.classCache.cache))
+}
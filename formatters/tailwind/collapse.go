@@ -0,0 +1,47 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// collapseSummaryClasses style the control expanding a collapsed block.
+const collapseSummaryClasses = "cursor-pointer select-none px-4 py-1 text-sm"
+
+// collapses reports whether a block of lineCount lines is collapsed by
+// MaxLines.
+func (f *Formatter) collapses(lineCount int) bool {
+	return f.maxLines > 0 && lineCount > f.maxLines
+}
+
+// writeCollapseStart opens the container of a block collapsed by MaxLines.
+//
+// The <details> element holding the control precedes the code, so that the
+// code can be expanded with its peer-open variant, but is shown after it.
+func (f *Formatter) writeCollapseStart(w io.Writer, classes map[chroma.TokenType]string, lineCount int) {
+	fmt.Fprintf(w, "<div%s>", f.utilityAttr("flex", "flex-col"))
+	fmt.Fprintf(w, "<details%s><summary%s>", f.utilityAttr("peer", "group", "order-last"), f.classAttr(classes, chroma.Background, collapseSummaryClasses))
+	fmt.Fprintf(w, "<span%s>Show all %d lines</span>", f.utilityAttr("group-open:hidden"), lineCount)
+	fmt.Fprintf(w, "<span%s>Show fewer lines</span>", f.utilityAttr("hidden", "group-open:inline"))
+	io.WriteString(w, "</summary></details>")
+	fmt.Fprintf(w, "<div%s>", f.utilityAttr(f.collapsedClasses()...))
+}
+
+// writeCollapseEnd closes the container opened by writeCollapseStart.
+func (f *Formatter) writeCollapseEnd(w io.Writer) {
+	io.WriteString(w, "</div></div>")
+}
+
+// collapsedClasses returns the unprefixed utilities limiting the height of the
+// code until it is expanded.
+func (f *Formatter) collapsedClasses() []string {
+	return []string{arbitraryValue("max-h", fmt.Sprintf("%dlh", f.maxLines)), "overflow-hidden", "peer-open:max-h-none"}
+}
+
+// collapseClasses returns every unprefixed utility added by MaxLines.
+func (f *Formatter) collapseClasses() []string {
+	out := []string{"flex", "flex-col", "peer", "group", "order-last", collapseSummaryClasses, "group-open:hidden", "hidden", "group-open:inline"}
+	return append(out, f.collapsedClasses()...)
+}
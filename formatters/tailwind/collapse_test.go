@@ -0,0 +1,32 @@
+package tailwind
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestMaxLines(t *testing.T) {
+	source := strings.Repeat("x\n", 30)
+	out := format(t, source, MaxLines(20))
+	assert.HasPrefix(t, out, `<div class="flex flex-col"><details class="peer group order-last"><summary class="bg-[#f7f7f7] cursor-pointer select-none px-4 py-1 text-sm">`+
+		`<span class="group-open:hidden">Show all 30 lines</span><span class="hidden group-open:inline">Show fewer lines</span></summary></details>`+
+		`<div class="max-h-[20lh] overflow-hidden peer-open:max-h-none"><pre class="bg-[#f7f7f7]">`)
+	assert.HasSuffix(t, out, "</code></pre></div></div>")
+
+	// Variants are outside the prefix.
+	out = format(t, source, MaxLines(20), ClassPrefix("tw-"), WithLineNumbers(true), LineNumbersInTable(true), Standalone(true))
+	assert.Contains(t, out, `<body class="tw-bg-[#f7f7f7]">`+"\n"+`<div class="tw-flex tw-flex-col">`)
+	assert.Contains(t, out, `<div class="tw-max-h-[20lh] tw-overflow-hidden peer-open:tw-max-h-none"><div class="tw-bg-[#f7f7f7]">`)
+	assert.Contains(t, out, "</tr></table>\n</div>\n</div></div>\n</body>")
+
+	classes := New(MaxLines(20), ClassPrefix("tw-")).ExtractClasses(styles.Get("github"), nil)
+	for _, class := range []string{"tw-max-h-[20lh]", "peer-open:tw-max-h-none", "group-open:tw-hidden", "tw-peer"} {
+		assert.SliceContains(t, classes, class)
+	}
+
+	assert.Equal(t, format(t, source), format(t, source, MaxLines(30)))
+}
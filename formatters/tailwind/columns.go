@@ -0,0 +1,84 @@
+package tailwind
+
+import (
+	"strings"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// defaultTabWidth is the width of a tab stop when TabWidth is not set, as in
+// browsers.
+const defaultTabWidth = 8
+
+// columnWalker tracks the visual column within a line as text is consumed,
+// expanding tabs to the next tab stop. Every other rune, including multibyte
+// ones, is one column wide.
+type columnWalker struct {
+	tabWidth int
+	col      int
+}
+
+// newColumnWalker returns a walker at the start of a line, using the tab width
+// of the formatter.
+func (f *Formatter) newColumnWalker() *columnWalker {
+	tabWidth := defaultTabWidth
+	if f.tabWidthSet && f.tabWidth > 0 {
+		tabWidth = f.tabWidth
+	}
+	return &columnWalker{tabWidth: tabWidth}
+}
+
+// next consumes r and returns the column following it. A newline returns to
+// the start of the line.
+func (c *columnWalker) next(r rune) int {
+	switch r {
+	case '\t':
+		c.col = (c.col/c.tabWidth + 1) * c.tabWidth
+	case '\n':
+		c.col = 0
+	default:
+		c.col++
+	}
+	return c.col
+}
+
+// walk consumes s and returns the column following it.
+func (c *columnWalker) walk(s string) int {
+	for _, r := range s {
+		c.next(r)
+	}
+	return c.col
+}
+
+// atTabStop reports whether the walker is at a tab stop.
+func (c *columnWalker) atTabStop() bool {
+	return c.col%c.tabWidth == 0
+}
+
+// expandLineTabs returns the tokens of a line with each tab replaced by the
+// spaces up to the next tab stop. Tokens are copied rather than modified, as
+// they may be shared.
+func (f *Formatter) expandLineTabs(tokens []chroma.Token) []chroma.Token {
+	walker := f.newColumnWalker()
+	out := make([]chroma.Token, len(tokens))
+	for i, token := range tokens {
+		if !strings.Contains(token.Value, "\t") {
+			walker.walk(token.Value)
+			out[i] = token
+			continue
+		}
+		var text strings.Builder
+		for _, r := range token.Value {
+			col := walker.col
+			if r == '\t' {
+				text.WriteString(strings.Repeat(" ", walker.next(r)-col))
+				continue
+			}
+			walker.next(r)
+			text.WriteRune(r)
+		}
+		token.Value = text.String()
+		out[i] = token
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package tailwind
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+func TestColumnWalker(t *testing.T) {
+	columns := New().newColumnWalker()
+	assert.Equal(t, 8, columns.walk("\t"))
+	assert.True(t, columns.atTabStop())
+	assert.Equal(t, 11, columns.walk("abc"))
+	assert.False(t, columns.atTabStop())
+	assert.Equal(t, 16, columns.walk("\t"))
+	assert.Equal(t, 0, columns.walk("x\n"))
+
+	columns = New(TabWidth(4)).newColumnWalker()
+	assert.Equal(t, 4, columns.walk("  \t"))
+	assert.Equal(t, 8, columns.walk("\t"))
+
+	// Multibyte runes are one column each.
+	columns = New(TabWidth(4)).newColumnWalker()
+	assert.Equal(t, 3, columns.walk("héé"))
+	assert.Equal(t, 4, columns.walk("\t"))
+	assert.Equal(t, 6, columns.walk("日本"))
+	assert.Equal(t, 8, columns.walk("\t"))
+}
+
+func TestExpandTabs(t *testing.T) {
+	tokens := []chroma.Token{{Type: chroma.Text, Value: "\t"}, {Type: chroma.Name, Value: "ab"}, {Type: chroma.Text, Value: "\tc\n"}}
+	assert.Equal(t, []chroma.Token{
+		{Type: chroma.Text, Value: "    "},
+		{Type: chroma.Name, Value: "ab"},
+		{Type: chroma.Text, Value: "  c\n"},
+	}, New(TabWidth(4)).expandLineTabs(tokens))
+	assert.Equal(t, "\t", tokens[0].Value)
+
+	source := "func main() {\n\tx := 1\n}\n"
+	out := format(t, source, ExpandTabs(true), TabWidth(4))
+	assert.Contains(t, out, `<span class="text-[#ffffff]">    </span><span class="text-[#1f2328]">x</span>`)
+	assert.NotContains(t, out, "\t")
+	assert.NotContains(t, out, "tab-size")
+
+	out = format(t, "func main() {\n \tx := 1\n}\n", ExpandTabs(true), FlagMixedIndent("bg-red-200"))
+	assert.Contains(t, out, `<span class="bg-red-200"><span class="text-[#ffffff]">        </span></span>`)
+}
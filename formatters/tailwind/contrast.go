@@ -0,0 +1,66 @@
+package tailwind
+
+import (
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// contrastFallbacks are the colours substituted by MinContrast, the one
+// contrasting best with the backgrounds being used.
+var contrastFallbacks = []chroma.Colour{chroma.MustParseColour("#000000"), chroma.MustParseColour("#ffffff")}
+
+// relativeLuminance returns the WCAG relative luminance of c, from 0 to 1.
+func relativeLuminance(c chroma.Colour) float64 {
+	return 0.2126*linearChannel(c.Red()) + 0.7152*linearChannel(c.Green()) + 0.0722*linearChannel(c.Blue())
+}
+
+// contrastRatio returns the WCAG contrast ratio of a and b, from 1 to 21.
+func contrastRatio(a, b chroma.Colour) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	return (max(la, lb) + 0.05) / (min(la, lb) + 0.05)
+}
+
+// contrastBackgrounds returns the backgrounds the text of type t of style is
+// shown on: its own, or, where it has none, that of the code and of
+// highlighted lines.
+func contrastBackgrounds(style *chroma.Style, t chroma.TokenType) []chroma.Colour {
+	entry := style.Get(t)
+	if !entry.Background.IsSet() {
+		return nil
+	}
+	out := []chroma.Colour{entry.Background}
+	if t == chroma.Background || tokenTypeIn(t, lineWrapperTypes) || entry.Background != style.Get(chroma.Background).Background {
+		return out
+	}
+	if highlight := style.Get(chroma.LineHighlight).Background; highlight.IsSet() && highlight != entry.Background {
+		out = append(out, highlight)
+	}
+	return out
+}
+
+// contrastFallback returns the colour replacing that of type t of style for
+// MinContrast, or an unset colour if it contrasts enough with each of its
+// backgrounds.
+func (f *Formatter) contrastFallback(style *chroma.Style, t chroma.TokenType) chroma.Colour {
+	colour := style.Get(t).Colour
+	backgrounds := contrastBackgrounds(style, t)
+	if f.minContrast <= 0 || !colour.IsSet() || len(backgrounds) == 0 {
+		return 0
+	}
+	lowest := func(c chroma.Colour) float64 {
+		ratio := 21.0
+		for _, bg := range backgrounds {
+			ratio = min(ratio, contrastRatio(c, bg))
+		}
+		return ratio
+	}
+	if lowest(colour) >= f.minContrast {
+		return 0
+	}
+	best := contrastFallbacks[0]
+	for _, c := range contrastFallbacks[1:] {
+		if lowest(c) > lowest(best) {
+			best = c
+		}
+	}
+	return best
+}
@@ -0,0 +1,45 @@
+package tailwind
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestContrastRatio(t *testing.T) {
+	assert.Equal(t, 21.0, contrastRatio(chroma.MustParseColour("#000000"), chroma.MustParseColour("#ffffff")))
+	assert.Equal(t, 1.0, contrastRatio(chroma.MustParseColour("#cf222e"), chroma.MustParseColour("#cf222e")))
+	ratio := contrastRatio(chroma.MustParseColour("#ffffff"), chroma.MustParseColour("#777777"))
+	assert.True(t, math.Abs(ratio-4.48) < 0.01, "%v", ratio)
+}
+
+func TestMinContrast(t *testing.T) {
+	light := chroma.MustNewStyle("light", chroma.StyleEntries{
+		chroma.Background:    "#24292f bg:#ffffff",
+		chroma.LineHighlight: "bg:#fff8c5",
+		chroma.Keyword:       "#cf222e",
+		chroma.Comment:       "#d0d0d0",
+		chroma.NameTag:       "#6e7781",
+		chroma.String:        "#ffffff bg:#0a3069",
+	})
+	dark := chroma.MustNewStyle("dark", chroma.StyleEntries{
+		chroma.Background: "#e6edf3 bg:#0d1117",
+		chroma.Keyword:    "#202020",
+	})
+	classes := New(MinContrast(4.5)).classes(light, dark)
+	// Too light on the background.
+	assert.Equal(t, "text-[#000000] dark:text-[inherit]", classes[chroma.Comment])
+	// Readable on the background, but not on highlighted lines.
+	assert.Equal(t, "text-[#000000] dark:text-[inherit]", classes[chroma.NameTag])
+	// Checked against its own background only.
+	assert.Equal(t, "text-[#ffffff] bg-[#0a3069] dark:text-[inherit] dark:bg-transparent", classes[chroma.String])
+	// Each style is checked separately.
+	assert.Equal(t, "text-[#cf222e] dark:text-[#ffffff]", classes[chroma.Keyword])
+
+	assert.Equal(t, "text-[#d0d0d0] dark:text-[inherit]", New().classes(light, dark)[chroma.Comment])
+	assert.Equal(t, New().classes(styles.Get("github"), nil), New(MinContrast(0)).classes(styles.Get("github"), nil))
+}
@@ -0,0 +1,64 @@
+package tailwind
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// diffLineType returns GenericInserted or GenericDeleted if that is the
+// dominant token type of a line, by length of text excluding whitespace, or
+// None otherwise.
+func diffLineType(tokens []chroma.Token) chroma.TokenType {
+	lengths := map[chroma.TokenType]int{}
+	dominant, longest := chroma.None, 0
+	for _, token := range tokens {
+		length := len(strings.TrimSpace(token.Value))
+		if length == 0 {
+			continue
+		}
+		lengths[token.Type] += length
+		if lengths[token.Type] > longest {
+			dominant, longest = token.Type, lengths[token.Type]
+		}
+	}
+	if dominant != chroma.GenericInserted && dominant != chroma.GenericDeleted {
+		return chroma.None
+	}
+	return dominant
+}
+
+// hasDiffLines reports whether any of lines is marked by DiffMarkers.
+func (f *Formatter) hasDiffLines(lines [][]chroma.Token) bool {
+	if !f.diffMarkers {
+		return false
+	}
+	for _, tokens := range lines {
+		if diffLineType(tokens) != chroma.None {
+			return true
+		}
+	}
+	return false
+}
+
+// diffMarker returns the gutter glyph of a line of type tt, padded to the width
+// of the widest glyph. Lines other than insertions and deletions get a blank
+// marker, keeping the code aligned.
+func (f *Formatter) diffMarker(classes map[chroma.TokenType]string, tt chroma.TokenType) string {
+	inserted, deleted := f.diffMarkerGlyphs[0], f.diffMarkerGlyphs[1]
+	width := max(utf8.RuneCountInString(inserted), utf8.RuneCountInString(deleted))
+	glyph := ""
+	switch tt {
+	case chroma.GenericInserted:
+		glyph = inserted
+	case chroma.GenericDeleted:
+		glyph = deleted
+	}
+	text := html.EscapeString(glyph) + strings.Repeat(" ", width-utf8.RuneCountInString(glyph))
+	if glyph == "" {
+		return "<span" + f.utilityAttr("whitespace-pre", "select-none") + ">" + text + "</span>"
+	}
+	return "<span" + f.classAttr(classes, tt, "whitespace-pre", "select-none") + ">" + text + "</span>"
+}
@@ -0,0 +1,52 @@
+package tailwind
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func formatDiff(t *testing.T, source string, options ...Option) string {
+	t.Helper()
+	it, err := lexers.Get("diff").Tokenise(nil, source)
+	assert.NoError(t, err)
+	out, err := New(options...).FormatString(styles.Get("github"), it)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestDiffLineType(t *testing.T) {
+	assert.Equal(t, chroma.GenericInserted, diffLineType([]chroma.Token{{Type: chroma.GenericInserted, Value: "+a\n"}}))
+	assert.Equal(t, chroma.GenericDeleted, diffLineType([]chroma.Token{{Type: chroma.Text, Value: "    "}, {Type: chroma.GenericDeleted, Value: "-ab"}, {Type: chroma.Comment, Value: "c\n"}}))
+	assert.Equal(t, chroma.None, diffLineType([]chroma.Token{{Type: chroma.GenericInserted, Value: "+"}, {Type: chroma.Text, Value: "abc\n"}}))
+	assert.Equal(t, chroma.None, diffLineType([]chroma.Token{{Type: chroma.Text, Value: "\n"}}))
+}
+
+func TestDiffMarkers(t *testing.T) {
+	source := " context\n-old\n+new\n"
+	out := formatDiff(t, source, DiffMarkers(true), WithLineNumbers(true))
+	assert.Contains(t, out, `<span class="flex"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">1</span><span class="whitespace-pre select-none"> </span><span class="grow"> context`)
+	assert.Contains(t, out, `<span class="text-[#82071e] bg-[#ffebe9] whitespace-pre select-none">-</span><span class="grow"><span class="text-[#82071e] bg-[#ffebe9]">-old`)
+	assert.Contains(t, out, `<span class="text-[#116329] bg-[#dafbe1] whitespace-pre select-none">+</span><span class="grow">`)
+
+	// A column of their own in table mode, next to the code.
+	out = formatDiff(t, source, DiffMarkers(true), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]"><span class="text-[#116329] bg-[#dafbe1] whitespace-pre select-none">+</span>`+"\n"+`</span></pre></td>`+"\n"+`<td class="align-top p-0 m-0 border-0 w-full">`)
+	assert.Equal(t, 3, strings.Count(out, "<td"))
+
+	// Glyphs are padded to the same width.
+	out = formatDiff(t, source, DiffMarkers(true), DiffMarkerGlyphs("++", "<"), ClassPrefix("tw-"))
+	assert.Contains(t, out, `<span class="tw-whitespace-pre tw-select-none">  </span>`)
+	assert.Contains(t, out, `select-none">&lt; </span>`)
+	assert.Contains(t, out, `select-none">++</span>`)
+
+	// Other content is unaffected.
+	plain := format(t, "package main\n")
+	assert.Equal(t, plain, format(t, "package main\n", DiffMarkers(true)))
+	assert.Equal(t, formatDiff(t, source), formatDiff(t, source, DiffMarkers(false)))
+}
@@ -0,0 +1,184 @@
+package tailwind
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// styleHashVersion is written first by StyleHash. Bump it whenever the options
+// written by writeHashOptions change, so hashes from older versions are not
+// mistaken for current ones.
+const styleHashVersion = 1
+
+// StyleHash returns a stable hex hash identifying the shape of the output for
+// the given styles: the sorted class map and the options affecting the markup.
+// Options given as functions or interfaces only count as set or not.
+//
+// Combined with a hash of the source, it can be used as a key for caching
+// rendered fragments. It is computed once for each pair of styles, and kept in
+// the class cache.
+func (f *Formatter) StyleHash(light, dark *chroma.Style) string {
+	return f.classCache.styleHash(light, dark, f.styleHash)
+}
+
+// styleHash computes the StyleHash of classes, which StyleHash keeps in the
+// class cache.
+func (f *Formatter) styleHash(classes map[chroma.TokenType]string) string {
+	tts := make([]int, 0, len(classes))
+	for tt := range classes {
+		tts = append(tts, int(tt))
+	}
+	sort.Ints(tts)
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "v%d\n", styleHashVersion)
+	for _, tt := range tts {
+		fmt.Fprintf(h, "%d=%s\n", tt, classes[chroma.TokenType(tt)])
+	}
+	f.writeHashOptions(h)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// writeHashOptions writes the options of f affecting the markup to w. The
+// styles and the options compiled into the classes, such as PaletteColors, are
+// covered by the class map, and the cache settings don't change the output.
+func (f *Formatter) writeHashOptions(w io.Writer) {
+	wheres := make([]string, 0, len(f.highlightWheres))
+	for _, where := range f.highlightWheres {
+		wheres = append(wheres, fmt.Sprintf("%v %s %t", where.ranges, where.class, where.pred != nil))
+	}
+	options := []struct {
+		name  string
+		value any
+	}{
+		{"standalone", f.standalone},
+		{"standaloneTitle", f.standaloneTitle},
+		{"standaloneBodyClass", f.standaloneBodyClass},
+		{"standaloneLang", f.standaloneLang},
+		{"standaloneHead", f.standaloneHead},
+		{"prefix", f.prefix},
+		{"preWrapper", fmt.Sprintf("%T", f.preWrapper)},
+		{"inlineCode", f.inlineCode},
+		{"inlineCodeBare", f.inlineCodeBare},
+		{"inlinePadding", f.inlinePadding},
+		{"inlineRounding", f.inlineRounding},
+		{"preventSurroundingPre", f.preventSurroundingPre},
+		{"tabWidth", f.tabWidth},
+		{"tabWidthSet", f.tabWidthSet},
+		{"expandTabs", f.expandTabs},
+		{"wrapLongLines", f.wrapLongLines},
+		{"wrapLines", f.wrapLines},
+		{"wrapIndent", f.wrapIndent},
+		{"lineNumbers", f.lineNumbers},
+		{"lineNumbersInTable", f.lineNumbersInTable},
+		{"lineNumbersRight", f.lineNumbersRight},
+		{"lineNumbersAsList", f.lineNumbersAsList},
+		{"lineNumberStep", f.lineNumberStep},
+		{"blockLineNumbers", f.blockLineNumbers},
+		{"compactGutter", f.compactGutter},
+		{"shrinkCodeColumn", f.shrinkCodeColumn},
+		{"linkableLineNumbers", f.linkableLineNumbers},
+		{"lineNumbersIDPrefix", f.lineNumbersIDPrefix},
+		{"lineLinkRel", f.lineLinkRel},
+		{"lineLinkTarget", f.lineLinkTarget},
+		{"lineAnchors", f.lineAnchors != nil},
+		{"baseLineNumber", f.baseLineNumber},
+		{"baseLineNumberSet", f.baseLineNumberSet},
+		{"zeroBasedLines", f.zeroBasedLines},
+		{"dualLineNumbers", f.dualLineNumbers != nil},
+		{"dualLineBases", f.dualLineBases},
+		{"lineWindows", f.lineWindows},
+		{"gapMarker", f.gapMarker},
+		{"gapMarkerClass", f.gapMarkerClass},
+		{"maxLines", f.maxLines},
+		{"trimTrailingNewline", f.trimTrailingNewline},
+		{"trimTrailingNewlineSet", f.trimTrailingNewlineSet},
+		{"highlightRanges", f.highlightRanges},
+		{"highlightLayout", f.highlightLayout},
+		{"highlightAccent", f.highlightAccent},
+		{"highlightDataAttribute", f.highlightDataAttribute},
+		{"highlightGroups", f.highlightGroups},
+		{"highlightLabels", f.highlightLabels},
+		{"highlightWheres", wheres},
+		{"highlightSpans", f.highlightSpans},
+		{"highlightViaGridRows", f.highlightViaGridRows},
+		{"highlightTOC", f.highlightTOC},
+		{"highlightTOCClass", f.highlightTOCClass},
+		{"highlightTOCLabel", f.highlightTOCLabel != nil},
+		{"highlightAnchors", f.highlightAnchors},
+		{"highlightAnchorClass", f.highlightAnchorClass},
+		{"highlightTokenFunc", f.highlightTokenFunc != nil},
+		{"highlightTokenTypes", f.highlightTokenTypes},
+		{"highlightTokenTypesClass", f.highlightTokenTypesClass},
+		{"dimUnhighlighted", f.dimUnhighlighted},
+		{"dimType", f.dimType},
+		{"dimClass", f.dimClass},
+		{"focusTransition", f.focusTransition},
+		{"omitPlainSpans", f.omitPlainSpans},
+		{"minimalPlainOutput", f.minimalPlainOutput},
+		{"mergeAdjacentTokens", f.mergeAdjacentTokens},
+		{"mergeWhitespace", f.mergeWhitespace},
+		{"wrapOnly", f.wrapOnly},
+		{"tokenNameAttribute", f.tokenNameAttribute},
+		{"tokenTitles", f.tokenTitles},
+		{"tokenPositionData", f.tokenPositionData},
+		{"tokenElements", f.tokenElements},
+		{"tokenColorVariables", f.tokenColorVariables},
+		{"customClasses", f.customClasses},
+		{"classOrder", f.classOrder},
+		{"classTransformer", f.classTransformer != nil},
+		{"sharedClasses", f.sharedClasses != nil},
+		{"withClasses", f.withClasses},
+		{"scrollSnap", f.scrollSnap},
+		{"separateThemeClasses", f.separateThemeClasses},
+		{"linesAsListItems", f.linesAsListItems},
+		{"flatLines", f.flatLines},
+		{"printBackground", f.printBackground},
+		{"printColors", f.printColors},
+		{"darkBackgroundFallback", f.darkBackgroundFallback},
+		{"darkModeStrategy", f.darkModeStrategy},
+		{"neutralDark", f.neutralDark},
+		{"neutralDarkBackground", f.neutralDarkBackground},
+		{"themeNames", f.themeNames},
+		{"whitespace", f.whitespace},
+		{"showWhitespace", f.showWhitespace},
+		{"indentGuides", f.indentGuides},
+		{"indentClass", f.indentClass},
+		{"flagMixedIndent", f.flagMixedIndent},
+		{"accessible", f.accessible},
+		{"plainFallback", f.plainFallback},
+		{"language", f.language},
+		{"languageContainerClass", f.languageContainerClass},
+		{"insertWordBreaks", f.insertWordBreaks},
+		{"metaColumn", f.metaColumn != nil},
+		{"sideAnnotations", f.sideAnnotations},
+		{"sideAnnotationClass", f.sideAnnotationClass},
+		{"contentVisibilityAuto", f.contentVisibilityAuto},
+		{"assumeEscaped", f.assumeEscaped},
+		{"codeColumnClass", f.codeColumnClass},
+		{"codePadding", f.codePadding},
+		{"nonPreWrapper", f.nonPreWrapper},
+		{"tableClasses", f.tableClasses},
+		{"tableCellClasses", f.tableCellClasses},
+		{"rowClass", f.rowClass},
+		{"outerDivClass", f.outerDivClass},
+		{"asGroup", f.asGroup},
+		{"errorTooltips", f.errorTooltips},
+		{"errorTooltipText", f.errorTooltipText},
+		{"minify", f.minify},
+		{"caption", f.caption},
+		{"captionClass", f.captionClass},
+		{"copyButton", f.copyButton},
+		{"nonce", f.nonce},
+		{"diffMarkers", f.diffMarkers},
+		{"diffMarkerGlyphs", f.diffMarkerGlyphs},
+		{"lineDataAttribute", f.lineDataAttribute},
+	}
+	for _, option := range options {
+		fmt.Fprintf(w, "%s=%v\n", option.name, option.value)
+	}
+}
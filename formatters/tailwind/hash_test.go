@@ -0,0 +1,73 @@
+package tailwind
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestStyleHash(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+
+	a := New(WithDarkStyle(dark)).StyleHash(light, dark)
+	b := New(WithDarkStyle(dark)).StyleHash(light, dark)
+	assert.Equal(t, a, b)
+	assert.Equal(t, 16, len(a))
+
+	assert.NotEqual(t, a, New().StyleHash(styles.Get("monokai"), dark))
+	assert.NotEqual(t, a, New(WithDarkStyle(dark), WithLineNumbers(true)).StyleHash(light, dark))
+}
+
+func TestStyleHashOptions(t *testing.T) {
+	light := styles.Get("github")
+	upper := func(class string) string { return strings.ToUpper(class) }
+	lower := func(class string) string { return class }
+	options := map[string][]Option{
+		"LinesAsListItems":     {LinesAsListItems(true)},
+		"TokenNameAttribute":   {TokenNameAttribute(true)},
+		"Minify":               {Minify(true)},
+		"WrapOnly":             {WrapOnly(chroma.Keyword)},
+		"OmitPlainSpans":       {OmitPlainSpans(true)},
+		"StandaloneTitle":      {Standalone(true), StandaloneTitle("a")},
+		"WithCustomClasses":    {WithCustomClasses(map[chroma.TokenType][]string{chroma.Keyword: {"a"}})},
+		"HighlightGroup":       {HighlightGroup("a", [][2]int{{1, 1}}, "a")},
+		"MaxLines":             {MaxLines(10)},
+		"LineDataAttribute":    {LineDataAttribute(true)},
+		"WithClassTransformer": {WithClassTransformer(upper)},
+		"Standalone":           {Standalone(true)},
+	}
+	seen := map[string]string{New().StyleHash(light, nil): "New"}
+	for name, opts := range options {
+		hash := New(opts...).StyleHash(light, nil)
+		other, ok := seen[hash]
+		assert.False(t, ok, "%s has the hash of %s", name, other)
+		seen[hash] = name
+		assert.Equal(t, hash, New(opts...).StyleHash(light, nil), name)
+	}
+
+	// Options given as functions only count as set.
+	assert.Equal(t,
+		New(WithClassTransformer(upper)).StyleHash(light, nil),
+		New(WithClassTransformer(lower)).StyleHash(light, nil))
+}
+
+func TestStyleHashArguments(t *testing.T) {
+	light, dark := styles.Get("github"), styles.Get("github-dark")
+
+	// The hash follows the styles given, not WithDarkStyle.
+	assert.Equal(t,
+		New().StyleHash(light, dark),
+		New(WithDarkStyle(styles.Get("monokai"))).StyleHash(light, dark))
+
+	// Only the classes of the styles given are compiled.
+	formatter := New()
+	formatter.StyleHash(light, dark)
+	assert.Equal(t, CacheStats{Misses: 1}, formatter.CacheStats())
+	formatter.StyleHash(light, dark)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, formatter.CacheStats())
+}
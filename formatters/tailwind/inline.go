@@ -0,0 +1,28 @@
+package tailwind
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+)
+
+// FormatInline highlights source, eg. from a Markdown code span, as a single
+// inline <code> element, as with InlineCode. lang is the name of a lexer; if
+// it is not found the source is not highlighted.
+func (f *Formatter) FormatInline(source, lang string, style *chroma.Style) (template.HTML, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, source)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := f.forBlock([]Option{InlineCode(true)}).Format(&buf, style, iterator); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil // nolint: gosec
+}
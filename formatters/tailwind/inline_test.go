@@ -0,0 +1,27 @@
+package tailwind
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestFormatInline(t *testing.T) {
+	out, err := New().FormatInline("x := <-ch\n", "go", styles.Get("github"))
+	assert.NoError(t, err)
+	s := string(out)
+	assert.HasPrefix(t, s, `<code class="`)
+	assert.HasSuffix(t, s, `</code>`)
+	assert.Equal(t, 1, strings.Count(s, "<code"))
+	assert.NotContains(t, s, "<pre")
+	assert.NotContains(t, s, "\n")
+	assert.Contains(t, s, `<span class="text-[#0550ae]">:=</span>`)
+	assert.Contains(t, s, "&lt;-")
+
+	out, err = New().FormatInline("plain", "no-such-language", styles.Get("github"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), ">plain</")
+}
@@ -0,0 +1,43 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// legendTypes are the token types shown by WriteLegend.
+var legendTypes = []chroma.TokenType{
+	chroma.Keyword,
+	chroma.KeywordType,
+	chroma.NameFunction,
+	chroma.NameClass,
+	chroma.NameBuiltin,
+	chroma.NameVariable,
+	chroma.LiteralString,
+	chroma.LiteralNumber,
+	chroma.Comment,
+	chroma.Operator,
+	chroma.Punctuation,
+	chroma.GenericInserted,
+	chroma.GenericDeleted,
+	chroma.Error,
+}
+
+// WriteLegend writes an HTML grid of the notable token types, each rendered
+// with the classes the formatter would give it. This is useful for previewing
+// and comparing styles.
+func (f *Formatter) WriteLegend(w io.Writer, light, dark *chroma.Style) error {
+	classes := f.classCache.get(light, dark)
+	if _, err := fmt.Fprintf(w, "<div%s>\n", f.classAttr(classes, chroma.Background, "grid gap-1 p-4")); err != nil {
+		return err
+	}
+	for _, tt := range legendTypes {
+		if _, err := fmt.Fprintf(w, "<span%s>%s</span>\n", f.classAttr(classes, tt), tt); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "</div>\n")
+	return err
+}
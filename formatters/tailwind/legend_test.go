@@ -0,0 +1,22 @@
+package tailwind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestWriteLegend(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	var buf bytes.Buffer
+	assert.NoError(t, New(WithDarkStyle(dark)).WriteLegend(&buf, light, dark))
+	out := buf.String()
+	assert.HasPrefix(t, out, `<div class="bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117] grid gap-1 p-4">`)
+	assert.Contains(t, out, `<span class="text-[#cf222e] dark:text-[#ff7b72]">Keyword</span>`)
+	assert.Contains(t, out, `<span class="text-[#57606a] dark:text-[#8b949e] dark:italic">Comment</span>`)
+	assert.HasSuffix(t, out, "</div>\n")
+}
@@ -0,0 +1,56 @@
+package tailwind
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// Block is a code block rendered by FormatMulti.
+type Block struct {
+	Tokens []chroma.Token
+	// Title, if set, is shown as a heading above the block.
+	Title string
+	// Options applied to the formatter for this block only.
+	Options []Option
+}
+
+// FormatMulti writes a single standalone document containing each of blocks,
+// sharing one <head>.
+func (f *Formatter) FormatMulti(w io.Writer, style *chroma.Style, blocks []Block) error {
+	ew := &errWriter{w: w}
+	w = ew
+	f.writeDocumentStart(w, f.classCache.get(style, f.darkStyle))
+	for _, block := range blocks {
+		formatter := f.forBlock(block.Options)
+		io.WriteString(w, "<section>"+f.newline())
+		if block.Title != "" {
+			fmt.Fprintf(w, "<h2>%s</h2>%s", html.EscapeString(block.Title), f.newline())
+		}
+		if err := formatter.writeHTML(w, style, block.Tokens, nil); err != nil {
+			return err
+		}
+		io.WriteString(w, f.newline()+"</section>"+f.newline())
+	}
+	f.writeDocumentEnd(w)
+	return ew.err
+}
+
+// forBlock returns a non-standalone copy of the formatter with options
+// applied.
+func (f *Formatter) forBlock(options []Option) *Formatter {
+	if len(options) == 0 && !f.standalone {
+		return f
+	}
+	clone := *f
+	clone.standalone = false
+	if len(options) > 0 {
+		clone.classCache = newClassCache(&clone)
+		for _, option := range options {
+			option(&clone)
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,39 @@
+package tailwind
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestFormatMulti(t *testing.T) {
+	tokenise := func(source string) Block {
+		it, err := lexers.Get("go").Tokenise(nil, source)
+		assert.NoError(t, err)
+		return Block{Tokens: it.Tokens()}
+	}
+	first := tokenise("package first\n")
+	first.Title = "first.go"
+	second := tokenise("package second\n")
+	second.Options = []Option{WithLineNumbers(true)}
+
+	var buf bytes.Buffer
+	formatter := New(Standalone(true))
+	assert.NoError(t, formatter.FormatMulti(&buf, styles.Get("github"), []Block{first, second}))
+	out := buf.String()
+	assert.HasPrefix(t, out, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n</head>\n<body class=\"bg-[#f7f7f7]\">\n<section>\n<h2>first.go</h2>\n<pre")
+	assert.HasSuffix(t, out, "</section>\n\n</body>\n</html>\n")
+	assert.Equal(t, 1, strings.Count(out, "<head>"))
+	assert.Equal(t, 1, strings.Count(out, "<body"))
+	assert.Equal(t, 2, strings.Count(out, "<pre"))
+	assert.Contains(t, out, ">first</span>")
+	assert.Contains(t, out, ">second</span>")
+	// Only the second block has line numbers.
+	assert.Equal(t, 1, strings.Count(out, "select-none"))
+	assert.False(t, formatter.lineNumbers)
+}
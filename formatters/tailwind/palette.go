@@ -0,0 +1,164 @@
+package tailwind
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// defaultPaletteMaxDistance is the CIELAB ΔE beyond which PaletteColors keeps
+// the exact colour. A ΔE of around 2 is just noticeable.
+const defaultPaletteMaxDistance = 10
+
+// paletteShades are the shades of each colour in the default Tailwind palette.
+var paletteShades = [...]int{50, 100, 200, 300, 400, 500, 600, 700, 800, 900, 950}
+
+// palette is the default Tailwind colour palette, with the colours of each
+// name in the order of paletteShades.
+var palette = []struct {
+	name   string
+	shades [len(paletteShades)]string
+}{
+	{"slate", [...]string{"#f8fafc", "#f1f5f9", "#e2e8f0", "#cbd5e1", "#94a3b8", "#64748b", "#475569", "#334155", "#1e293b", "#0f172a", "#020617"}},
+	{"gray", [...]string{"#f9fafb", "#f3f4f6", "#e5e7eb", "#d1d5db", "#9ca3af", "#6b7280", "#4b5563", "#374151", "#1f2937", "#111827", "#030712"}},
+	{"zinc", [...]string{"#fafafa", "#f4f4f5", "#e4e4e7", "#d4d4d8", "#a1a1aa", "#71717a", "#52525b", "#3f3f46", "#27272a", "#18181b", "#09090b"}},
+	{"neutral", [...]string{"#fafafa", "#f5f5f5", "#e5e5e5", "#d4d4d4", "#a3a3a3", "#737373", "#525252", "#404040", "#262626", "#171717", "#0a0a0a"}},
+	{"stone", [...]string{"#fafaf9", "#f5f5f4", "#e7e5e4", "#d6d3d1", "#a8a29e", "#78716c", "#57534e", "#44403c", "#292524", "#1c1917", "#0c0a09"}},
+	{"red", [...]string{"#fef2f2", "#fee2e2", "#fecaca", "#fca5a5", "#f87171", "#ef4444", "#dc2626", "#b91c1c", "#991b1b", "#7f1d1d", "#450a0a"}},
+	{"orange", [...]string{"#fff7ed", "#ffedd5", "#fed7aa", "#fdba74", "#fb923c", "#f97316", "#ea580c", "#c2410c", "#9a3412", "#7c2d12", "#431407"}},
+	{"amber", [...]string{"#fffbeb", "#fef3c7", "#fde68a", "#fcd34d", "#fbbf24", "#f59e0b", "#d97706", "#b45309", "#92400e", "#78350f", "#451a03"}},
+	{"yellow", [...]string{"#fefce8", "#fef9c3", "#fef08a", "#fde047", "#facc15", "#eab308", "#ca8a04", "#a16207", "#854d0e", "#713f12", "#422006"}},
+	{"lime", [...]string{"#f7fee7", "#ecfccb", "#d9f99d", "#bef264", "#a3e635", "#84cc16", "#65a30d", "#4d7c0f", "#3f6212", "#365314", "#1a2e05"}},
+	{"green", [...]string{"#f0fdf4", "#dcfce7", "#bbf7d0", "#86efac", "#4ade80", "#22c55e", "#16a34a", "#15803d", "#166534", "#14532d", "#052e16"}},
+	{"emerald", [...]string{"#ecfdf5", "#d1fae5", "#a7f3d0", "#6ee7b7", "#34d399", "#10b981", "#059669", "#047857", "#065f46", "#064e3b", "#022c22"}},
+	{"teal", [...]string{"#f0fdfa", "#ccfbf1", "#99f6e4", "#5eead4", "#2dd4bf", "#14b8a6", "#0d9488", "#0f766e", "#115e59", "#134e4a", "#042f2e"}},
+	{"cyan", [...]string{"#ecfeff", "#cffafe", "#a5f3fc", "#67e8f9", "#22d3ee", "#06b6d4", "#0891b2", "#0e7490", "#155e75", "#164e63", "#083344"}},
+	{"sky", [...]string{"#f0f9ff", "#e0f2fe", "#bae6fd", "#7dd3fc", "#38bdf8", "#0ea5e9", "#0284c7", "#0369a1", "#075985", "#0c4a6e", "#082f49"}},
+	{"blue", [...]string{"#eff6ff", "#dbeafe", "#bfdbfe", "#93c5fd", "#60a5fa", "#3b82f6", "#2563eb", "#1d4ed8", "#1e40af", "#1e3a8a", "#172554"}},
+	{"indigo", [...]string{"#eef2ff", "#e0e7ff", "#c7d2fe", "#a5b4fc", "#818cf8", "#6366f1", "#4f46e5", "#4338ca", "#3730a3", "#312e81", "#1e1b4b"}},
+	{"violet", [...]string{"#f5f3ff", "#ede9fe", "#ddd6fe", "#c4b5fd", "#a78bfa", "#8b5cf6", "#7c3aed", "#6d28d9", "#5b21b6", "#4c1d95", "#2e1065"}},
+	{"purple", [...]string{"#faf5ff", "#f3e8ff", "#e9d5ff", "#d8b4fe", "#c084fc", "#a855f7", "#9333ea", "#7e22ce", "#6b21a8", "#581c87", "#3b0764"}},
+	{"fuchsia", [...]string{"#fdf4ff", "#fae8ff", "#f5d0fe", "#f0abfc", "#e879f9", "#d946ef", "#c026d3", "#a21caf", "#86198f", "#701a75", "#4a044e"}},
+	{"pink", [...]string{"#fdf2f8", "#fce7f3", "#fbcfe8", "#f9a8d4", "#f472b6", "#ec4899", "#db2777", "#be185d", "#9d174d", "#831843", "#500724"}},
+	{"rose", [...]string{"#fff1f2", "#ffe4e6", "#fecdd3", "#fda4af", "#fb7185", "#f43f5e", "#e11d48", "#be123c", "#9f1239", "#881337", "#4c0519"}},
+}
+
+// paletteEntry is a palette colour, eg. "violet-600", in CIELAB.
+type paletteEntry struct {
+	name string
+	lab  [3]float64
+}
+
+// paletteLab returns the palette, including black and white, in CIELAB.
+var paletteLab = sync.OnceValue(func() []paletteEntry {
+	entries := []paletteEntry{
+		{"black", toLab(chroma.MustParseColour("#000000"))},
+		{"white", toLab(chroma.MustParseColour("#ffffff"))},
+	}
+	for _, colour := range palette {
+		for i, hex := range colour.shades {
+			entries = append(entries, paletteEntry{colour.name + "-" + strconv.Itoa(paletteShades[i]), toLab(chroma.MustParseColour(hex))})
+		}
+	}
+	return entries
+})
+
+// nearestPaletteColour returns the name of the palette colour closest to c, and
+// its distance as CIELAB ΔE (CIE76).
+func nearestPaletteColour(c chroma.Colour) (name string, distance float64) {
+	lab := toLab(c)
+	distance = math.Inf(1)
+	for _, entry := range paletteLab() {
+		d := math.Sqrt(square(lab[0]-entry.lab[0]) + square(lab[1]-entry.lab[1]) + square(lab[2]-entry.lab[2]))
+		if d < distance {
+			name, distance = entry.name, d
+		}
+	}
+	return name, distance
+}
+
+// toLab converts an sRGB colour to CIELAB, with a D65 white point.
+func toLab(c chroma.Colour) [3]float64 {
+	r, g, b := linearChannel(c.Red()), linearChannel(c.Green()), linearChannel(c.Blue())
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// linearChannel converts an sRGB channel to linear light, from 0 to 1.
+func linearChannel(v uint8) float64 {
+	s := float64(v) / 255
+	if s <= 0.04045 {
+		return s / 12.92
+	}
+	return math.Pow((s+0.055)/1.055, 2.4)
+}
+
+func square(v float64) float64 { return v * v }
+
+// colourUtility returns the utility (eg. "text" or "bg") setting c, using the
+// nearest palette colour with PaletteColors if it is close enough, and an
+// arbitrary value otherwise.
+func (f *Formatter) colourUtility(utility string, c chroma.Colour) string {
+	if f.canonicalColors {
+		c = withoutOpaqueAlpha(c)
+	}
+	if f.paletteColors {
+		if name, distance := nearestPaletteColour(c); distance <= f.paletteMaxDistance {
+			return utility + "-" + name
+		}
+	}
+	return arbitraryValue(utility, f.colourString(c))
+}
+
+// colourString serializes c with the ColorSerializer, if any.
+func (f *Formatter) colourString(c chroma.Colour) string {
+	out := c.String()
+	if f.colorSerializer != nil {
+		out = f.colorSerializer(c)
+	}
+	if f.canonicalColors {
+		out = canonicalColour(out)
+	}
+	return out
+}
+
+// withoutOpaqueAlpha returns c without the alpha channel of a style colour
+// given as #rrggbbff, which chroma parses into the bits above the RGB value.
+func withoutOpaqueAlpha(c chroma.Colour) chroma.Colour {
+	if v := uint32(c - 1); c.IsSet() && v > 0xffffff && v&0xff == 0xff {
+		return chroma.Colour(v>>8 + 1)
+	}
+	return c
+}
+
+// canonicalColour returns a hex colour as lowercase #rrggbb, expanding #rgb
+// and dropping an opaque alpha channel. Other values are returned unchanged.
+func canonicalColour(colour string) string {
+	hex, ok := strings.CutPrefix(colour, "#")
+	if !ok || strings.Trim(hex, "0123456789abcdefABCDEF") != "" {
+		return colour
+	}
+	hex = strings.ToLower(hex)
+	switch {
+	case len(hex) == 4 && hex[3] == 'f':
+		hex = hex[:3]
+	case len(hex) == 8 && hex[6:] == "ff":
+		hex = hex[:6]
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	return "#" + hex
+}
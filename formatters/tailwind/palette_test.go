@@ -0,0 +1,90 @@
+package tailwind
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestToLab(t *testing.T) {
+	white := toLab(chroma.MustParseColour("#ffffff"))
+	assert.True(t, math.Abs(white[0]-100) < 0.01 && math.Abs(white[1]) < 0.01 && math.Abs(white[2]) < 0.01, "%v", white)
+	assert.Equal(t, [3]float64{0, 0, 0}, toLab(chroma.MustParseColour("#000000")))
+}
+
+func TestNearestPaletteColour(t *testing.T) {
+	name, distance := nearestPaletteColour(chroma.MustParseColour("#7c3aed"))
+	assert.Equal(t, "violet-600", name)
+	assert.Equal(t, 0.0, distance)
+	name, distance = nearestPaletteColour(chroma.MustParseColour("#7f3cf0"))
+	assert.Equal(t, "violet-600", name)
+	assert.True(t, distance > 0 && distance < 2, "%v", distance)
+	name, _ = nearestPaletteColour(chroma.MustParseColour("#010101"))
+	assert.Equal(t, "black", name)
+}
+
+func TestPaletteColors(t *testing.T) {
+	style := chroma.MustNewStyle("palette", chroma.StyleEntries{
+		chroma.Background: "bg:#f8fafc",
+		chroma.Keyword:    "#7f3cf0",
+		chroma.Comment:    "#00ff00",
+	})
+	classes := New(PaletteColors(true)).classes(style, nil)
+	assert.Equal(t, "text-violet-600", classes[chroma.Keyword])
+	assert.Equal(t, "bg-slate-50", classes[chroma.Background])
+	// Too far from any palette colour.
+	assert.Equal(t, "text-[#00ff00]", classes[chroma.Comment])
+
+	classes = New(PaletteColors(true), PaletteMaxDistance(0.5)).classes(style, nil)
+	assert.Equal(t, "text-[#7f3cf0]", classes[chroma.Keyword])
+	assert.Equal(t, "bg-slate-50", classes[chroma.Background])
+
+	assert.Equal(t, "text-[#7f3cf0]", New().classes(style, nil)[chroma.Keyword])
+}
+
+func TestCanonicalColors(t *testing.T) {
+	assert.Equal(t, "#ffffff", canonicalColour("#FFFFFFFF"))
+	assert.Equal(t, "#aabbcc", canonicalColour("#ABCF"))
+	assert.Equal(t, "#aabbcc", canonicalColour("#abc"))
+	assert.Equal(t, "#8913af", canonicalColour("#8913AF"))
+	assert.Equal(t, "#8913af80", canonicalColour("#8913af80"))
+	assert.Equal(t, "rgb(1 2 3)", canonicalColour("rgb(1 2 3)"))
+
+	style := chroma.MustNewStyle("alpha", chroma.StyleEntries{
+		chroma.Background: "bg:#f7f7f7",
+		chroma.Keyword:    "#CF222EFF",
+	})
+	classes := New(CanonicalColors(true)).classes(style, nil)
+	assert.Equal(t, "text-[#cf222e]", classes[chroma.Keyword])
+	assert.Equal(t, "bg-[#f7f7f7]", classes[chroma.Background])
+	assert.Equal(t, "text-violet-600", New(CanonicalColors(true), PaletteColors(true)).classes(
+		chroma.MustNewStyle("alpha", chroma.StyleEntries{chroma.Keyword: "#7C3AEDFF"}), nil)[chroma.Keyword])
+
+	upper := ColorSerializer(func(c chroma.Colour) string { return strings.ToUpper(c.String()) + "FF" })
+	assert.Equal(t, "text-[#cf222e]", New(upper, CanonicalColors(true)).classes(styles.Get("github"), nil)[chroma.Keyword])
+	assert.Equal(t, "text-[#CF222EFF]", New(upper).classes(styles.Get("github"), nil)[chroma.Keyword])
+}
+
+func TestColorSerializer(t *testing.T) {
+	rgb := ColorSerializer(func(c chroma.Colour) string {
+		return fmt.Sprintf("rgb(%d %d %d)", c.Red(), c.Green(), c.Blue())
+	})
+	classes := New(rgb, TabWidth(4)).classes(styles.Get("github"), styles.Get("github-dark"))
+	assert.Equal(t, "text-[rgb(207_34_46)] dark:text-[rgb(255_123_114)]", classes[chroma.Keyword])
+	assert.Equal(t, "bg-[rgb(247_247_247)] dark:text-[rgb(230_237_243)] dark:bg-[rgb(13_17_23)]", classes[chroma.Background])
+	assert.Contains(t, classes[chroma.PreWrapper], "[tab-size:4]")
+	for tt, class := range classes {
+		assert.False(t, strings.Contains(class, "#"), "%s: %s", tt, class)
+	}
+
+	var buf strings.Builder
+	assert.NoError(t, New(rgb).WriteVariables(&buf, ".github", styles.Get("github")))
+	assert.NotContains(t, buf.String(), "#")
+	assert.Contains(t, buf.String(), ": rgb(207 34 46);")
+}
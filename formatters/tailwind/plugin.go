@@ -0,0 +1,55 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// WritePlugin writes a Tailwind plugin that exposes the style as component
+// classes (".chroma" for the wrapper, ".chroma-k" for keywords, etc.) built
+// with @apply from the same utilities the formatter emits inline.
+//
+// The resulting file can be added to the "plugins" list of a Tailwind config.
+func (f *Formatter) WritePlugin(w io.Writer, light, dark *chroma.Style) error {
+	classes := f.utilityClasses(light, dark)
+	tts := make([]int, 0, len(classes))
+	for tt := range classes {
+		tts = append(tts, int(tt))
+	}
+	sort.Ints(tts)
+
+	if _, err := fmt.Fprint(w, "const plugin = require('tailwindcss/plugin')\n\nmodule.exports = plugin(function ({ addComponents }) {\n  addComponents({\n"); err != nil {
+		return err
+	}
+	for _, ti := range tts {
+		tt := chroma.TokenType(ti)
+		selector := f.semanticClass(tt)
+		if selector == "" || classes[tt] == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "    %s: { %s: {} },\n", strconv.Quote("."+selector), strconv.Quote("@apply "+classes[tt])); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "  })\n})\n")
+	return err
+}
+
+// semanticClass returns the stable component class name for tt, derived from
+// chroma's short token type names, or "" if tt has none. It is shared by
+// WithClasses, WriteCSS and WritePlugin, so all carry the ClassPrefix.
+func (f *Formatter) semanticClass(tt chroma.TokenType) string {
+	short := chroma.StandardTypes[tt]
+	switch {
+	case short == "":
+		return ""
+	case tt == chroma.PreWrapper:
+		return f.prefix + short
+	default:
+		return f.prefix + "chroma-" + short
+	}
+}
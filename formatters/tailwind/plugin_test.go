@@ -0,0 +1,40 @@
+package tailwind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestWritePlugin(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	var buf bytes.Buffer
+	err := New(WithDarkStyle(dark)).WritePlugin(&buf, light, dark)
+	assert.NoError(t, err)
+	out := buf.String()
+	assert.Contains(t, out, "addComponents({\n")
+	assert.Contains(t, out, `".chroma": { "@apply bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117]": {} },`)
+	assert.Contains(t, out, `".chroma-k": { "@apply text-[#cf222e] dark:text-[#ff7b72]": {} },`)
+	assert.Contains(t, out, `".chroma-c": { "@apply text-[#57606a] dark:text-[#8b949e] dark:italic": {} },`)
+}
+
+func TestWritePluginWithClasses(t *testing.T) {
+	light := styles.Get("github")
+	var buf bytes.Buffer
+	err := New(WithClasses(true), ClassPrefix("tw-")).WritePlugin(&buf, light, nil)
+	assert.NoError(t, err)
+	out := buf.String()
+	assert.Contains(t, out, `".tw-chroma": { "@apply tw-bg-[#f7f7f7]": {} },`)
+	assert.Contains(t, out, `".tw-chroma-k": { "@apply tw-text-[#cf222e]": {} },`)
+	assert.NotContains(t, out, "@apply tw-chroma")
+
+	// The classes in the HTML are the ones the plugin defines.
+	html := format(t, "package main\n", WithClasses(true), ClassPrefix("tw-"))
+	assert.HasPrefix(t, html, `<pre class="tw-chroma"><code><span class="tw-chroma-line">`)
+	var css bytes.Buffer
+	assert.NoError(t, New(WithClasses(true), ClassPrefix("tw-")).WriteCSS(&css, light))
+	assert.Contains(t, css.String(), "  .tw-chroma-kn { @apply tw-text-[#cf222e]; }\n")
+}
@@ -0,0 +1,91 @@
+package tailwind
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseLineRanges parses a comma-separated list of line numbers and "a-b"
+// ranges (eg. "10-20,30-35") for use with LineWindows.
+//
+// The returned ranges are sorted, and overlapping or adjacent ranges are merged.
+func ParseLineRanges(s string) ([][2]int, error) {
+	ranges, err := parseRanges(s)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRanges(ranges), nil
+}
+
+// ParseHighlightRanges parses a comma-separated list of line numbers and "a-b"
+// ranges (eg. "1-3,5,7-9,12"), as found in Markdown fences, for use with
+// HighlightLines. A single line n becomes the range {n, n}.
+//
+// The ranges are returned in the order given, which numbers them for
+// HighlightDataAttribute.
+func ParseHighlightRanges(spec string) ([][2]int, error) {
+	return parseRanges(spec)
+}
+
+// parseRanges parses a comma-separated list of single lines and inclusive
+// "a-b" ranges, preserving the order they were given in.
+func parseRanges(spec string) ([][2]int, error) {
+	out := [][2]int{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty line range in %q", spec)
+		}
+		start, end, isRange := strings.Cut(part, "-")
+		first, err := parseLine(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line range %q: %w", part, err)
+		}
+		last := first
+		if isRange {
+			if last, err = parseLine(end); err != nil {
+				return nil, fmt.Errorf("invalid line range %q: %w", part, err)
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid line range %q: end is before start", part)
+			}
+		}
+		out = append(out, [2]int{first, last})
+	}
+	return out, nil
+}
+
+func parseLine(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("missing line number")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a line number", s)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("line number %d is negative", n)
+	}
+	return n, nil
+}
+
+// mergeRanges sorts ranges and merges those that overlap or touch.
+func mergeRanges(ranges [][2]int) [][2]int {
+	sorted := make([][2]int, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	out := [][2]int{}
+	for _, r := range sorted {
+		if n := len(out); n > 0 && r[0] <= out[n-1][1]+1 {
+			if r[1] > out[n-1][1] {
+				out[n-1][1] = r[1]
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
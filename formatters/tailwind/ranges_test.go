@@ -0,0 +1,37 @@
+package tailwind
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseLineRanges(t *testing.T) {
+	ranges, err := ParseLineRanges("30-35, 10-20,5")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{5, 5}, {10, 20}, {30, 35}}, ranges)
+
+	ranges, err = ParseLineRanges("10-20,15-25,26,40-41")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{10, 26}, {40, 41}}, ranges)
+
+	for _, spec := range []string{"", "3-", "-3", "5-2", "a-b", "1,,2"} {
+		_, err = ParseLineRanges(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseHighlightRanges(t *testing.T) {
+	ranges, err := ParseHighlightRanges("1-3, 5 ,7 - 9,12")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{1, 3}, {5, 5}, {7, 9}, {12, 12}}, ranges)
+
+	ranges, err = ParseHighlightRanges("9,2-4")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{9, 9}, {2, 4}}, ranges)
+
+	for _, spec := range []string{"", "3-", "4-2", "-1", "x", "1,,2", "1-2-3"} {
+		_, err = ParseHighlightRanges(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,54 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// ClassRegistry assigns short class names to the lists of utilities emitted by
+// formatters using SharedClasses. It is safe for concurrent use.
+type ClassRegistry struct {
+	mu    sync.Mutex
+	names map[string]string
+	// Utility lists in the order they were registered.
+	utilities []string
+}
+
+// NewClassRegistry creates an empty ClassRegistry.
+func NewClassRegistry() *ClassRegistry {
+	return &ClassRegistry{names: map[string]string{}}
+}
+
+// name returns the short class name for utilities, registering it if needed.
+func (r *ClassRegistry) name(utilities string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name, ok := r.names[utilities]; ok {
+		return name
+	}
+	r.utilities = append(r.utilities, utilities)
+	name := "c" + strconv.Itoa(len(r.utilities))
+	r.names[utilities] = name
+	return name
+}
+
+// WriteCSS writes a stylesheet defining each registered class with @apply.
+//
+// The stylesheet must be processed by Tailwind, eg. by appending it to the
+// input CSS, so it should be written after all blocks have been formatted.
+func (r *ClassRegistry) WriteCSS(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := fmt.Fprint(w, "@layer components {\n"); err != nil {
+		return err
+	}
+	for _, utilities := range r.utilities {
+		if _, err := fmt.Fprintf(w, "  .%s { @apply %s; }\n", r.names[utilities], utilities); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
@@ -0,0 +1,28 @@
+package tailwind
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSharedClasses(t *testing.T) {
+	registry := NewClassRegistry()
+	first := format(t, "package main\n", SharedClasses(registry))
+	var css bytes.Buffer
+	assert.NoError(t, registry.WriteCSS(&css))
+	defined := strings.Count(css.String(), "@apply")
+
+	second := format(t, "package other\n", SharedClasses(registry))
+	assert.Equal(t, first, strings.Replace(second, "other", "main", 1))
+	assert.HasPrefix(t, first, `<pre class="c1"><code><span class="c2"><span class="c3"><span class="c4">package</span>`)
+	assert.NotContains(t, first, "text-[")
+
+	css.Reset()
+	assert.NoError(t, registry.WriteCSS(&css))
+	assert.Equal(t, defined, strings.Count(css.String(), "@apply"))
+	assert.HasPrefix(t, css.String(), "@layer components {\n  .c1 { @apply bg-[#f7f7f7]; }\n  .c2 { @apply flex; }\n")
+	assert.Contains(t, css.String(), "  .c3 { @apply grow; }\n  .c4 { @apply text-[#cf222e]; }\n")
+}
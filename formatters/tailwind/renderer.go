@@ -0,0 +1,87 @@
+package tailwind
+
+import (
+	"crypto/sha256"
+	"io"
+	"sync"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+const rendererCacheLimit = 64
+
+type tokenCacheEntry struct {
+	key    [sha256.Size]byte
+	tokens []chroma.Token
+}
+
+// Renderer formats source with a fixed lexer, style and Formatter, caching
+// the tokens of recently rendered sources so that repeated renders of the same
+// snippet skip tokenisation. It is safe for concurrent use.
+type Renderer struct {
+	lexer     chroma.Lexer
+	style     *chroma.Style
+	formatter *Formatter
+
+	mu sync.Mutex
+	// LRU cache of tokens keyed by a hash of the source, with the most recently
+	// used entry last.
+	cache []tokenCacheEntry
+}
+
+// NewRenderer creates a Renderer.
+func NewRenderer(lexer chroma.Lexer, style *chroma.Style, f *Formatter) *Renderer {
+	return &Renderer{lexer: lexer, style: style, formatter: f}
+}
+
+// Render formats source to w.
+func (r *Renderer) Render(w io.Writer, source string) error {
+	tokens, err := r.tokens(source)
+	if err != nil {
+		return err
+	}
+	return r.formatter.Format(w, r.style, chroma.Literator(tokens...))
+}
+
+func (r *Renderer) tokens(source string) ([]chroma.Token, error) {
+	key := sha256.Sum256([]byte(source))
+
+	r.mu.Lock()
+	tokens, ok := r.cached(key)
+	r.mu.Unlock()
+	if ok {
+		return tokens, nil
+	}
+
+	it, err := r.lexer.Tokenise(nil, source)
+	if err != nil {
+		return nil, err
+	}
+	tokens = it.Tokens()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Another call may have tokenised the same source in the meantime.
+	if cached, ok := r.cached(key); ok {
+		return cached, nil
+	}
+	if len(r.cache) >= rendererCacheLimit {
+		r.cache = r.cache[0:copy(r.cache, r.cache[1:])]
+	}
+	r.cache = append(r.cache, tokenCacheEntry{key: key, tokens: tokens})
+	return tokens, nil
+}
+
+// cached returns the tokens cached for key, moving them to the end of the LRU.
+// r.mu must be held.
+func (r *Renderer) cached(key [sha256.Size]byte) ([]chroma.Token, bool) {
+	for i := len(r.cache) - 1; i >= 0; i-- {
+		entry := r.cache[i]
+		if entry.key == key {
+			copy(r.cache[i:], r.cache[i+1:])
+			r.cache[len(r.cache)-1] = entry
+			return entry.tokens, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,73 @@
+package tailwind
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+type countingLexer struct {
+	chroma.Lexer
+	calls int
+}
+
+func (l *countingLexer) Tokenise(options *chroma.TokeniseOptions, text string) (chroma.Iterator, error) {
+	l.calls++
+	return l.Lexer.Tokenise(options, text)
+}
+
+func TestRenderer(t *testing.T) {
+	lexer := &countingLexer{Lexer: lexers.Get("go")}
+	renderer := NewRenderer(lexer, styles.Get("github"), New())
+
+	var first, second bytes.Buffer
+	assert.NoError(t, renderer.Render(&first, "package main\n"))
+	assert.NoError(t, renderer.Render(&second, "package main\n"))
+	assert.Equal(t, 1, lexer.calls)
+	assert.Equal(t, first.String(), second.String())
+	assert.Equal(t, format(t, "package main\n"), first.String())
+
+	assert.NoError(t, renderer.Render(&first, "package other\n"))
+	assert.Equal(t, 2, lexer.calls)
+
+	for i := 0; i < rendererCacheLimit; i++ {
+		assert.NoError(t, renderer.Render(&first, string(rune('a'+i%26))+string(rune('a'+i/26))))
+	}
+	assert.Equal(t, rendererCacheLimit, len(renderer.cache))
+	assert.NoError(t, renderer.Render(&first, "package main\n"))
+	assert.Equal(t, 3+rendererCacheLimit, lexer.calls)
+}
+
+// barrierLexer holds each call to Tokenise until all of them have started.
+type barrierLexer struct {
+	chroma.Lexer
+	started *sync.WaitGroup
+}
+
+func (l *barrierLexer) Tokenise(options *chroma.TokeniseOptions, text string) (chroma.Iterator, error) {
+	l.started.Done()
+	l.started.Wait()
+	return l.Lexer.Tokenise(options, text)
+}
+
+func TestRendererConcurrentMisses(t *testing.T) {
+	const renders = 4
+	var started, done sync.WaitGroup
+	started.Add(renders)
+	renderer := NewRenderer(&barrierLexer{Lexer: lexers.Get("go"), started: &started}, styles.Get("github"), New())
+	for range renders {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			assert.NoError(t, renderer.Render(&bytes.Buffer{}, "package main\n"))
+		}()
+	}
+	done.Wait()
+	assert.Equal(t, 1, len(renderer.cache))
+}
@@ -0,0 +1,188 @@
+package tailwind
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// ExtractClasses returns the sorted, de-duplicated list of Tailwind classes
+// the formatter can emit for the given styles.
+//
+// This is useful for safelisting, as the Tailwind scanner never sees the
+// classes embedded in generated HTML. The classes include those added by
+// options, except for those that depend on the source: the classes returned
+// by a HighlightTokenFunc, and the row-start-[n] and row-end-[n] placements of
+// HighlightViaGridRows, which follow the lines of each highlighted range.
+func (f *Formatter) ExtractClasses(light, dark *chroma.Style) []string {
+	classes := f.classCache.get(light, dark)
+	seen := map[string]bool{}
+	for _, cls := range classes {
+		for _, class := range strings.Fields(cls) {
+			seen[class] = true
+		}
+	}
+	for _, class := range f.prefixedClasses(f.optionClasses()) {
+		seen[class] = true
+	}
+	out := make([]string, 0, len(seen))
+	for class := range seen {
+		out = append(out, class)
+	}
+	if f.classTransformer != nil {
+		transformed := map[string]bool{}
+		for _, class := range f.transformClasses(out) {
+			transformed[class] = true
+		}
+		out = out[:0]
+		for class := range transformed {
+			out = append(out, class)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// UsedClasses returns the sorted, de-duplicated list of every class the
+// formatter emits for the given styles, for a Tailwind safelist. It is
+// ExtractClasses under the name used by the build tooling.
+func (f *Formatter) UsedClasses(light, dark *chroma.Style) []string {
+	return f.ExtractClasses(light, dark)
+}
+
+// optionClasses returns the unprefixed utilities added to the markup by the
+// options of the formatter, beyond the compiled classes of each token type.
+func (f *Formatter) optionClasses() []string {
+	var out []string
+	add := func(classes ...string) {
+		for _, class := range classes {
+			out = append(out, strings.Fields(class)...)
+		}
+	}
+	add(f.codePadding, f.whitespaceClass())
+	if f.lineNumbers && f.lineNumbersInTable {
+		add(f.codeColumnClasses(), f.rowClass, f.outerDivClass)
+		if f.blockLineNumbers {
+			add("block")
+		}
+		if f.sideAnnotations != nil {
+			add(f.sideAnnotationClass)
+		}
+	}
+	if f.standalone {
+		add(f.standaloneBodyClass)
+		if f.copyButton {
+			add("relative", copyButtonClasses)
+		}
+	}
+	if f.captioned() {
+		add(f.captionClass)
+	}
+	if f.wrapsLines() && !f.flatLines {
+		add("min-h-[1lh]")
+	}
+	if f.listItems() {
+		add("list-none", "m-0", "p-0")
+	}
+	if f.lineWindows != nil {
+		add("select-none", f.gapMarkerClass)
+	}
+	if len(f.highlightRanges) > 0 {
+		add(f.highlightAccentClasses())
+		if f.highlightAnchors != "" {
+			add(f.highlightAnchorClass)
+		}
+		if f.gridRowHighlights() {
+			add(gridRowsContainerClasses...)
+			add("absolute", "inset-0", "-z-10", "pointer-events-none")
+		}
+		if f.highlightTOC {
+			add(f.highlightTOCClass)
+		}
+	}
+	for _, group := range f.highlightGroups {
+		add(group.class)
+	}
+	for _, where := range f.highlightWheres {
+		add(where.class)
+	}
+	if len(f.highlightRanges) > 0 || len(f.highlightGroups) > 0 {
+		add(f.dimUnhighlighted)
+	}
+	if f.accessible && f.hasHighlights() {
+		add("sr-only", "select-none")
+	}
+	if f.wrapLines != nil {
+		add("whitespace-pre-wrap", "break-words")
+	}
+	if f.scrollSnap {
+		add("snap-start")
+	}
+	if f.plainFallback {
+		add("sr-only")
+	}
+	if f.flagMixedIndent != "" {
+		add(f.flagMixedIndent)
+	} else if f.indentGuides {
+		add(indentGuideClasses)
+	} else {
+		add(f.indentClass)
+	}
+	add(f.showWhitespace)
+	if f.highlightTokenTypes != nil {
+		add(f.highlightTokenTypesClass)
+	}
+	if f.errorTooltips {
+		add(errorTooltipClasses)
+	}
+	if f.maxLines > 0 {
+		add(f.collapseClasses()...)
+	}
+	if f.diffMarkers {
+		add("whitespace-pre", "select-none")
+	}
+	return out
+}
+
+// WriteSafelist writes the classes returned by ExtractClasses in a
+// ready-to-paste format.
+//
+// Supported formats are "js" (a Tailwind config "safelist" entry), "txt" (one
+// class per line, suitable as a content source) and "json" (an array of
+// strings).
+func (f *Formatter) WriteSafelist(w io.Writer, format string, light, dark *chroma.Style) error {
+	classes := f.ExtractClasses(light, dark)
+	switch format {
+	case "js":
+		if _, err := fmt.Fprint(w, "safelist: [\n"); err != nil {
+			return err
+		}
+		for _, class := range classes {
+			if _, err := fmt.Fprintf(w, "  %q,\n", class); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprint(w, "],\n")
+		return err
+	case "txt":
+		for _, class := range classes {
+			if _, err := fmt.Fprintln(w, class); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(classes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	default:
+		return fmt.Errorf("unsupported safelist format %q", format)
+	}
+}
@@ -0,0 +1,132 @@
+package tailwind
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestWriteSafelist(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	formatter := New(WithDarkStyle(dark))
+	classes := formatter.ExtractClasses(light, dark)
+	assert.SliceContains(t, classes, "flex")
+	assert.SliceContains(t, classes, "dark:bg-[#0d1117]")
+
+	var buf bytes.Buffer
+	assert.NoError(t, formatter.WriteSafelist(&buf, "txt", light, dark))
+	assert.Equal(t, strings.Join(classes, "\n")+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, formatter.WriteSafelist(&buf, "json", light, dark))
+	var decoded []string
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, classes, decoded)
+
+	buf.Reset()
+	assert.NoError(t, formatter.WriteSafelist(&buf, "js", light, dark))
+	out := buf.String()
+	assert.HasPrefix(t, out, "safelist: [\n")
+	assert.Contains(t, out, "  \"dark:bg-[#0d1117]\",\n")
+	assert.HasSuffix(t, out, "],\n")
+
+	assert.Error(t, formatter.WriteSafelist(&buf, "yaml", light, dark))
+}
+
+func TestExtractClassesDeterministic(t *testing.T) {
+	light, dark := styles.Get("github"), styles.Get("github-dark")
+	first := New(WithLineNumbers(true), LineNumbersInTable(true)).ExtractClasses(light, dark)
+	for range 10 {
+		// A new formatter each time, so the classes are compiled afresh.
+		assert.Equal(t, first, New(WithLineNumbers(true), LineNumbersInTable(true)).ExtractClasses(light, dark))
+	}
+	assert.True(t, slices.IsSorted(first))
+}
+
+func TestExtractClassesOptions(t *testing.T) {
+	light := styles.Get("github")
+	classes := New().ExtractClasses(light, nil)
+	assert.SliceContains(t, classes, "min-h-[1lh]")
+	assert.SliceContains(t, classes, "grow")
+	assert.False(t, slices.Contains(classes, "sr-only"))
+
+	classes = New(
+		ClassPrefix("tw-"),
+		TabWidth(4),
+		WithLineNumbers(true),
+		LineNumbersInTable(true),
+		HighlightLines([][2]int{{1, 2}}),
+		HighlightAccent("border-[#f00]"),
+		HighlightGroup("error", [][2]int{{3, 3}}, "bg-red-100"),
+		Accessible(true),
+		IndentGuides(true),
+		ErrorTooltips(true),
+	).ExtractClasses(light, nil)
+	for _, class := range []string{
+		"tw-[tab-size:4]", "tw-w-full", "tw-border-separate", "tw-align-top", "tw-select-none",
+		"tw-border-l-4", "tw-border-[#f00]", "tw-bg-red-100", "tw-sr-only",
+		"tw-border-l", "tw-border-gray-500/30", "tw--ml-px", "tw-decoration-wavy",
+	} {
+		assert.SliceContains(t, classes, class)
+	}
+}
+
+func TestUsedClassesCoverOutput(t *testing.T) {
+	light, dark := styles.Get("github"), styles.Get("github-dark")
+	source := "package main\n\n// Comment\nfunc main() {\n\tif x {\n  \treturn \"a b\"\n\t}\n}\n"
+	highlights := HighlightLines([][2]int{{2, 3}, {5, 5}})
+	for i, options := range [][]Option{
+		nil,
+		{WithDarkStyle(dark)},
+		{WithDarkStyle(dark), ClassPrefix("tw-")},
+		{WithLineNumbers(true), highlights, Accessible(true), DimUnhighlighted("opacity-50")},
+		{WithLineNumbers(true), LineNumbersInTable(true), BlockLineNumbers(true), highlights, HighlightAnchors("h")},
+		{WithLineNumbers(true), LineNumbersInTable(true), SideAnnotations(map[int]string{2: "note"}, "italic")},
+		{WithLineNumbers(true), DualLineNumbers(1, 1, func(line int) (int, int) { return line, line })},
+		{highlights, HighlightViaGridRows(true), ClassPrefix("tw-")},
+		{highlights, HighlightGroup("error", [][2]int{{4, 4}}, "bg-red-100"), WithHighlightTOC(true)},
+		{WithClasses(true), PreventSurroundingPre(true)},
+		{WithClasses(true), InlineCode(true)},
+		{WithClasses(true), DiffMarkers(true), WithLineNumbers(true)},
+		{PreventSurroundingPre(true), WithLineNumbers(true), ClassPrefix("tw-")},
+		{InlineCode(true), ClassPrefix("tw-")},
+		{DiffMarkers(true), ClassPrefix("tw-")},
+		{Standalone(true), WithCopyButton(true), WithCaption("main.go")},
+		{WrapLongLines(true), WrapLines([][2]int{{1, 3}}), ScrollSnap(true), WithPlainFallback(true)},
+		{IndentGuides(true), ShowWhitespace("text-gray-400"), TabWidth(4), ErrorTooltips(true)},
+		{FlagMixedIndent("bg-red-200"), LinesAsListItems(true)},
+		{LineWindows([][2]int{{1, 2}, {6, 8}}), GapMarker("...", "italic")},
+		{MaxLines(3), ClassPrefix("tw-")},
+		{HighlightTokenTypes([]chroma.TokenType{chroma.Comment}, "underline"), DimComments(true)},
+		{WithClassTransformer(strings.ToUpper), highlights},
+	} {
+		used := New(options...).UsedClasses(light, dark)
+		for _, diff := range []bool{false, true} {
+			var out string
+			if diff {
+				out = formatDiff(t, "+a\n-b\n c\n", options...)
+			} else {
+				out = format(t, source, options...)
+			}
+			for _, match := range regexp.MustCompile(` class="([^"]*)"`).FindAllStringSubmatch(out, -1) {
+				for _, class := range strings.Fields(match[1]) {
+					// The grid placements depend on the source.
+					if strings.Contains(class, "row-start-[") || strings.Contains(class, "row-end-[") {
+						continue
+					}
+					if !slices.Contains(used, class) {
+						t.Errorf("options %d: %q is not in UsedClasses", i, class)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package tailwind
+
+import (
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// WriteShell writes the opening markup of the themed wrapper that Format would
+// place around the code, without any code, and returns it along with the
+// matching closing markup. Callers can then stream their own content into the
+// wrapper before writing close, eg. for a skeleton loader.
+func (f *Formatter) WriteShell(w io.Writer, light, dark *chroma.Style) (open, close string, err error) {
+	classes := f.classCache.get(light, dark)
+	open = f.preStart(true, f.classAttr(classes, chroma.PreWrapper, f.codePadding), -1)
+	close = f.preEnd(true)
+	_, err = io.WriteString(w, open)
+	return open, close, err
+}
@@ -0,0 +1,25 @@
+package tailwind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestWriteShell(t *testing.T) {
+	var buf bytes.Buffer
+	open, close, err := New(CodePadding("p-4 rounded")).WriteShell(&buf, styles.Get("github"), styles.Get("github-dark"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<pre class="bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117] p-4 rounded"><code>`, open)
+	assert.Equal(t, `</code></pre>`, close)
+	assert.Equal(t, open, buf.String())
+
+	buf.Reset()
+	open, close, err = New(InlineCode(true)).WriteShell(&buf, styles.Get("github"), nil)
+	assert.NoError(t, err)
+	assert.HasPrefix(t, open, `<code class="`)
+	assert.Equal(t, `</code>`, close)
+}
@@ -0,0 +1,24 @@
+package tailwind
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// FormatSkeleton writes the raw source, escaped but not highlighted, in a
+// <pre> carrying the wrapper classes and data attributes describing the block:
+// its language, line count, and the StyleHash of the styles. This allows very
+// large pages to defer highlighting to the client.
+func (f *Formatter) FormatSkeleton(w io.Writer, source, lang string, style *chroma.Style) error {
+	lines := strings.Count(source, "\n")
+	if source != "" && !strings.HasSuffix(source, "\n") {
+		lines++
+	}
+	_, err := fmt.Fprintf(w, `<pre%s data-lang="%s" data-lines="%d" data-style-hash="%s"><code>%s</code></pre>`,
+		f.joinedClassAttr(f.CodeClasses(style, f.darkStyle)), html.EscapeString(lang), lines, f.StyleHash(style, f.darkStyle), html.EscapeString(source))
+	return err
+}
@@ -0,0 +1,31 @@
+package tailwind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestFormatSkeleton(t *testing.T) {
+	formatter := New()
+	style := styles.Get("github")
+	var buf bytes.Buffer
+	assert.NoError(t, formatter.FormatSkeleton(&buf, "if a < b {\n}\n", "go", style))
+	assert.Equal(t, `<pre class="bg-[#f7f7f7]" data-lang="go" data-lines="2" data-style-hash="`+
+		formatter.StyleHash(style, nil)+"\"><code>if a &lt; b {\n}\n</code></pre>", buf.String())
+}
+
+func TestFormatSkeletonHashOnce(t *testing.T) {
+	formatter := New()
+	style := styles.Get("github")
+	for range 3 {
+		assert.NoError(t, formatter.FormatSkeleton(&bytes.Buffer{}, "a\n", "go", style))
+	}
+	// The classes and their hash are compiled for the first block only.
+	assert.Equal(t, CacheStats{Hits: 5, Misses: 1}, formatter.CacheStats())
+	assert.Equal(t, 1, len(formatter.classCache.cache))
+	assert.Equal(t, formatter.StyleHash(style, nil), formatter.classCache.cache[0].hash)
+}
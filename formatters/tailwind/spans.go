@@ -0,0 +1,74 @@
+package tailwind
+
+import (
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// writeSpanHighlights writes tokens, wrapping the text within spans in a
+// LineHighlight span. walker is at the column preceding tokens.
+func (f *Formatter) writeSpanHighlights(w io.Writer, classes map[chroma.TokenType]string, tokens []chroma.Token, line, offset int, walker *columnWalker, spans []Span) {
+	var run []chroma.Token
+	highlighted := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if highlighted {
+			io.WriteString(w, "<span"+f.classAttr(classes, chroma.LineHighlight)+">")
+		}
+		f.writeTokens(w, classes, run, line, offset)
+		if highlighted {
+			io.WriteString(w, "</span>")
+		}
+		for _, token := range run {
+			offset += len(token.Value)
+		}
+		run = run[:0]
+	}
+	for _, token := range tokens {
+		for _, piece := range splitTokenBySpans(token, walker, spans) {
+			if piece.highlighted != highlighted {
+				flush()
+				highlighted = piece.highlighted
+			}
+			run = append(run, piece.token)
+		}
+	}
+	flush()
+}
+
+// spanPiece is part of a token, inside or outside of a span.
+type spanPiece struct {
+	token       chroma.Token
+	highlighted bool
+}
+
+// splitTokenBySpans splits token where it enters or leaves one of spans,
+// advancing walker past it. A rune is within a span if any of the columns it
+// occupies are, so a tab is never split.
+func splitTokenBySpans(token chroma.Token, walker *columnWalker, spans []Span) []spanPiece {
+	var pieces []spanPiece
+	start := 0
+	highlighted := false
+	for i, r := range token.Value {
+		before := walker.col
+		after := walker.next(r)
+		in := false
+		if r != '\n' {
+			for _, span := range spans {
+				if after >= span.Start && before < span.End {
+					in = true
+					break
+				}
+			}
+		}
+		if i > 0 && in != highlighted {
+			pieces = append(pieces, spanPiece{chroma.Token{Type: token.Type, Value: token.Value[start:i]}, highlighted})
+			start = i
+		}
+		highlighted = in
+	}
+	return append(pieces, spanPiece{chroma.Token{Type: token.Type, Value: token.Value[start:]}, highlighted})
+}
@@ -0,0 +1,34 @@
+package tailwind
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+func TestSplitTokenBySpans(t *testing.T) {
+	walker := &columnWalker{tabWidth: 4}
+	pieces := splitTokenBySpans(chroma.Token{Type: chroma.Text, Value: "\tabc\n"}, walker, []Span{{Start: 3, End: 5}})
+	assert.Equal(t, []spanPiece{
+		{chroma.Token{Type: chroma.Text, Value: "\ta"}, true},
+		{chroma.Token{Type: chroma.Text, Value: "bc\n"}, false},
+	}, pieces)
+	assert.Equal(t, 0, walker.col)
+}
+
+func TestHighlightSpans(t *testing.T) {
+	source := "package main\n\n\tx := 1\n"
+	out := format(t, source, HighlightSpans([]Span{{Line: 1, Start: 3, End: 10}, {Line: 3, Start: 9, End: 9}}))
+	assert.Contains(t, out, `<span class="grow"><span class="text-[#cf222e]">pa</span><span class="bg-[#dedede]"><span class="text-[#cf222e]">ckage</span><span class="text-[#ffffff]"> </span><span class="text-[#1f2328]">ma</span></span><span class="text-[#1f2328]">in</span>`)
+	// The tab spans columns 1 to 8.
+	assert.Contains(t, out, `<span class="text-[#ffffff]">	</span><span class="bg-[#dedede]"><span class="text-[#1f2328]">x</span></span><span class="text-[#ffffff]"> </span>`)
+
+	out = format(t, source, HighlightSpans([]Span{{Line: 3, Start: 5, End: 5}}), TabWidth(4))
+	assert.Contains(t, out, `<span class="bg-[#dedede]"><span class="text-[#1f2328]">x</span></span>`)
+
+	out = format(t, source, HighlightSpans([]Span{{Line: 1, Start: 3, End: 10}}), HighlightLines([][2]int{{1, 1}}))
+	assert.Equal(t, 1, strings.Count(out, "bg-[#dedede]"))
+}
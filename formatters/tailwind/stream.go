@@ -0,0 +1,98 @@
+package tailwind
+
+import (
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// canStream reports whether the output can be written while the tokens are
+// read, without knowing the number of lines in advance. Line numbers are
+// padded to the width of the last one, and the accessible label, open-ended
+// highlights, plain fallback and copy button all depend on the whole source.
+func (f *Formatter) canStream() bool {
+	if _, ok := f.preWrapper.(PreWrapperWithContext); ok {
+		// The wrapper is given the number of lines.
+		return false
+	}
+	return !f.lineNumbers && !f.accessible && !f.plainFallback && !(f.copyButton && f.standalone) &&
+		!f.diffMarkers && f.maxLines <= 0 && f.withHighlightsEndingAt(0) == f
+}
+
+// writeIterator writes the tokens of iterator, streaming them a line at a time
+// where possible so that memory use is bounded by the longest line.
+func (f *Formatter) writeIterator(w io.Writer, style *chroma.Style, iterator chroma.Iterator, beforeLine func(rendered int) error) error {
+	if !f.canStream() {
+		return f.writeHTML(w, style, iterator.Tokens(), beforeLine)
+	}
+	trim := f.trimTrailingNewline || (!f.trimTrailingNewlineSet && f.inlineCode)
+	lines := &lineReader{iterator: iterator, trim: trim}
+	return f.writeLines(w, style, lines.next, -1, nil, beforeLine)
+}
+
+// lineReader splits the tokens of an iterator into lines as they are read, in
+// the same way as chroma.SplitTokensIntoLines. With trim the trailing newline
+// is removed, as by trimTrailingNewline.
+type lineReader struct {
+	iterator chroma.Iterator
+	trim     bool
+	complete [][]chroma.Token // Lines read but not yet returned.
+	line     []chroma.Token   // The incomplete line being read.
+	eof      bool
+	finished bool
+}
+
+// next returns the next line, or false once all lines have been returned.
+func (r *lineReader) next() ([]chroma.Token, bool) {
+	// Trimming can only affect the last complete line and anything after it,
+	// so that line is held back until more of the source has been read.
+	held := 0
+	if r.trim {
+		held = 1
+	}
+	for !r.eof && len(r.complete) <= held {
+		token := r.iterator()
+		if token == chroma.EOF {
+			r.eof = true
+			break
+		}
+		r.add(token)
+	}
+	if r.eof && !r.finished {
+		// Split the remainder in one go so the end of the source is handled
+		// exactly as by SplitTokensIntoLines.
+		var rest []chroma.Token
+		for _, line := range r.complete {
+			rest = append(rest, line...)
+		}
+		rest = append(rest, r.line...)
+		if r.trim {
+			rest = trimTrailingNewline(rest)
+		}
+		r.complete, r.line, r.finished = chroma.SplitTokensIntoLines(rest), nil, true
+	}
+	if len(r.complete) == 0 {
+		return nil, false
+	}
+	line := r.complete[0]
+	r.complete = slices.Delete(r.complete, 0, 1)
+	return line, true
+}
+
+// add adds token to the lines read.
+func (r *lineReader) add(token chroma.Token) {
+	for strings.Contains(token.Value, "\n") {
+		head, tail, _ := strings.Cut(token.Value, "\n")
+		clone := token.Clone()
+		clone.Value = head + "\n"
+		r.complete = append(r.complete, append(r.line, clone))
+		r.line = nil
+		token.Value = tail
+		if tail == "" {
+			return
+		}
+	}
+	r.line = append(r.line, token)
+}
@@ -0,0 +1,91 @@
+package tailwind
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+	"github.com/akfaew/chroma-tailwind/v2/lexers"
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestLineReader(t *testing.T) {
+	text := func(value string) chroma.Token { return chroma.Token{Type: chroma.Text, Value: value} }
+	for _, tokens := range [][]chroma.Token{
+		nil,
+		{text("a")},
+		{text("a\n")},
+		{text("a\n"), text("")},
+		{text("a\n"), text("\n")},
+		{text("a\nb\n\nc"), text("d\n")},
+		{text("a\n"), text(""), text("b")},
+		{text(""), text("\n"), text("")},
+		{text("\n\n\n")},
+	} {
+		for _, trim := range []bool{false, true} {
+			expected := tokens
+			if trim {
+				expected = trimTrailingNewline(expected)
+			}
+			reader := &lineReader{iterator: chroma.Literator(tokens...), trim: trim}
+			var lines [][]chroma.Token
+			for line, ok := reader.next(); ok; line, ok = reader.next() {
+				lines = append(lines, line)
+			}
+			expectedLines := chroma.SplitTokensIntoLines(expected)
+			if len(expectedLines) == 0 {
+				expectedLines = nil
+			}
+			assert.Equal(t, expectedLines, lines, "%q trim=%t", tokens, trim)
+		}
+	}
+}
+
+func TestStreamedFormat(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tprintln(`hello`)\n}\n\n"
+	for _, options := range [][]Option{
+		nil,
+		{InlineCode(true)},
+		{TrimTrailingNewline(true), HighlightLines([][2]int{{2, 4}})},
+		{LineWindows([][2]int{{1, 2}, {4, 5}}), HighlightViaGridRows(true), HighlightLines([][2]int{{4, 4}})},
+	} {
+		formatter := New(options...)
+		assert.True(t, formatter.canStream())
+		tokens, err := lexers.Get("go").Tokenise(nil, source)
+		assert.NoError(t, err)
+		all := tokens.Tokens()
+		var streamed, buffered bytes.Buffer
+		assert.NoError(t, formatter.Format(&streamed, styles.Get("github"), chroma.Literator(all...)))
+		assert.NoError(t, formatter.writeHTML(&buffered, styles.Get("github"), all, nil))
+		assert.Equal(t, buffered.String(), streamed.String())
+	}
+	assert.False(t, New(WithLineNumbers(true)).canStream())
+	assert.False(t, New(HighlightLines([][2]int{{2, -1}})).canStream())
+}
+
+func BenchmarkFormatLarge(b *testing.B) {
+	source := strings.Repeat("2024-01-01T00:00:00Z INFO request served path=/index.html status=200\n", 10000)
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(b, err)
+	all := tokens.Tokens()
+	style := styles.Get("github")
+	formatter := New()
+	var buf bytes.Buffer
+	b.Run("Streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			buf.Reset()
+			assert.NoError(b, formatter.Format(&buf, style, chroma.Literator(all...)))
+		}
+	})
+	b.Run("Buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			buf.Reset()
+			assert.NoError(b, formatter.writeHTML(&buf, style, chroma.Literator(all...).Tokens(), nil))
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// WriteCSS writes a stylesheet defining the semantic classes used with
+// WithClasses for style and the dark style, with @apply. It must be processed
+// by Tailwind, eg. by appending it to the input CSS.
+func (f *Formatter) WriteCSS(w io.Writer, style *chroma.Style) error {
+	classes := f.utilityClasses(style, f.darkStyle)
+	if _, err := fmt.Fprint(w, "@layer components {\n"); err != nil {
+		return err
+	}
+	for _, tt := range standardTypes() {
+		if f.semanticClass(tt) == "" || classes[tt] == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "  .%s { @apply %s; }\n", f.semanticClass(tt), classes[tt]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
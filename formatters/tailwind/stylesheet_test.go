@@ -0,0 +1,30 @@
+package tailwind
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestWithClasses(t *testing.T) {
+	dark := WithDarkStyle(styles.Get("github-dark"))
+	out := format(t, "package main\n", WithClasses(true), dark)
+	assert.HasPrefix(t, out, `<pre class="chroma"><code><span class="chroma-line"><span class="chroma-cl"><span class="chroma-kn">package</span>`)
+	assert.NotContains(t, out, "text-[")
+
+	var css bytes.Buffer
+	assert.NoError(t, New(WithClasses(true), dark).WriteCSS(&css, styles.Get("github")))
+	assert.HasPrefix(t, css.String(), "@layer components {\n")
+	assert.Contains(t, css.String(), "  .chroma { @apply bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117]; }\n")
+	assert.Contains(t, css.String(), "  .chroma-kn { @apply text-[#cf222e] dark:text-[#ff7b72]; }\n")
+	assert.HasSuffix(t, css.String(), "}\n")
+
+	// Every class in the HTML is defined by the stylesheet.
+	for _, match := range regexp.MustCompile(`class="([^"]+)"`).FindAllStringSubmatch(out, -1) {
+		assert.Contains(t, css.String(), "  ."+match[1]+" { @apply ")
+	}
+}
@@ -1,13 +1,18 @@
 package tailwind
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"io"
+	"maps"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/akfaew/chroma-tailwind/v2"
 )
@@ -18,16 +23,65 @@ type Option func(f *Formatter)
 // Standalone configures the formatter for generating a standalone HTML document.
 func Standalone(b bool) Option { return func(f *Formatter) { f.standalone = b } }
 
+// StandaloneTitle sets the <title> of a standalone document. The code is also
+// wrapped in a region labelled with the title so screen readers can navigate
+// to it.
+func StandaloneTitle(title string) Option { return func(f *Formatter) { f.standaloneTitle = title } }
+
+// StandaloneBodyClass adds classes (eg. "p-8 font-mono") to the <body> of a
+// standalone document.
+func StandaloneBodyClass(classes string) Option {
+	return func(f *Formatter) { f.standaloneBodyClass = classes }
+}
+
+// StandaloneLang sets the lang attribute of a standalone document, "en" by
+// default.
+func StandaloneLang(lang string) Option { return func(f *Formatter) { f.standaloneLang = lang } }
+
+// StandaloneHead adds markup (eg. a <link> to a stylesheet) to the <head> of a
+// standalone document. It is written as is, without escaping.
+func StandaloneHead(markup string) Option { return func(f *Formatter) { f.standaloneHead = markup } }
+
 // ClassPrefix sets the Tailwind class prefix (eg. "tw-").
 func ClassPrefix(prefix string) Option { return func(f *Formatter) { f.prefix = prefix } }
 
+// ExpandTabs replaces tabs with spaces up to the next tab stop, so that code
+// stays aligned where the tab-size property is unsupported or stripped, such
+// as in email. The [tab-size:N] utility of TabWidth is then omitted. With
+// TokenPositionData, the offsets within a line count the spaces in place of
+// its tabs.
+func ExpandTabs(b bool) Option {
+	return func(f *Formatter) {
+		f.expandTabs = b
+	}
+}
+
 // WithDarkStyle sets the dark theme style used for dark mode variants.
 func WithDarkStyle(style *chroma.Style) Option { return func(f *Formatter) { f.darkStyle = style } }
 
-// TabWidth sets the number of characters for a tab. Defaults to 8.
-func TabWidth(width int) Option { return func(f *Formatter) { f.tabWidth = width } }
+// TabWidth sets the number of characters for a tab.
+//
+// When set, a [tab-size:N] utility is always emitted, even for 8. When unset,
+// no utility is emitted and the browser default (8) applies.
+func TabWidth(width int) Option {
+	return func(f *Formatter) {
+		f.tabWidth = width
+		f.tabWidthSet = true
+	}
+}
 
 // PreventSurroundingPre prevents the surrounding pre tags around the generated code.
+//
+// The theme background is normally applied to the <pre>, so use CodeClasses to
+// obtain the classes to apply to your own element.
+//
+// The code is wrapped in a <span> with just the Whitespace utility, so its
+// whitespace is preserved, but lines are not wrapped in elements of their own.
+// With WithLineNumbers, each line is instead preceded by its number, as in
+//
+//	<span class="whitespace-pre"><span class="whitespace-pre select-none ...">1</span><span ...>package</span>...
+//
+// always to the left of the code.
 func PreventSurroundingPre(b bool) Option {
 	return func(f *Formatter) {
 		f.preventSurroundingPre = b
@@ -63,6 +117,58 @@ func InlineCode(b bool) Option {
 	}
 }
 
+// InlineCodeBare creates inline code without a surrounding <code> tag, for use
+// inside an existing <code> element. The token spans are wrapped in a single
+// <span> carrying the background and whitespace-preserving classes.
+func InlineCodeBare(b bool) Option {
+	return func(f *Formatter) {
+		f.inlineCode = b
+		f.inlineCodeBare = b
+		f.preWrapper = preWrapper{
+			start: func(code bool, classAttr string) string {
+				if code {
+					return fmt.Sprintf(`<span%s>`, classAttr)
+				}
+
+				return ``
+			},
+			end: func(code bool) string {
+				if code {
+					return `</span>`
+				}
+
+				return ``
+			},
+		}
+	}
+}
+
+// TrimTrailingNewline drops a single trailing newline from the source, so that
+// it doesn't render as a line break. Defaults to true for InlineCode and
+// InlineCodeBare, where the code should stay on one line.
+func TrimTrailingNewline(b bool) Option {
+	return func(f *Formatter) {
+		f.trimTrailingNewline = b
+		f.trimTrailingNewlineSet = true
+	}
+}
+
+// InlinePadding sets the padding utilities applied to the <code> element of
+// InlineCode. Defaults to "px-1".
+func InlinePadding(class string) Option {
+	return func(f *Formatter) {
+		f.inlinePadding = class
+	}
+}
+
+// InlineRounding sets the border radius utility applied to the <code> element
+// of InlineCode. Defaults to "rounded".
+func InlineRounding(class string) Option {
+	return func(f *Formatter) {
+		f.inlineRounding = class
+	}
+}
+
 // WithPreWrapper allows control of the surrounding pre tags.
 func WithPreWrapper(wrapper PreWrapper) Option {
 	return func(f *Formatter) {
@@ -70,6 +176,38 @@ func WithPreWrapper(wrapper PreWrapper) Option {
 	}
 }
 
+var wrapperTagRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*$`)
+
+// WithWrapperTag sets the element names used by the default wrapper in place of
+// <pre> and <code>, eg. "div" for a grid based layout. An empty code tag omits
+// the inner element.
+//
+// Panics if either name is not a simple element name.
+func WithWrapperTag(pre, code string) Option {
+	if !wrapperTagRe.MatchString(pre) || (code != "" && !wrapperTagRe.MatchString(code)) {
+		panic(fmt.Sprintf("tailwind: invalid wrapper tag names %q, %q", pre, code))
+	}
+	return func(f *Formatter) {
+		f.nonPreWrapper = pre != "pre"
+		f.preWrapper = preWrapper{
+			start: func(isCode bool, classAttr string) string {
+				if isCode && code != "" {
+					return fmt.Sprintf(`<%s%s><%s>`, pre, classAttr, code)
+				}
+
+				return fmt.Sprintf(`<%s%s>`, pre, classAttr)
+			},
+			end: func(isCode bool) string {
+				if isCode && code != "" {
+					return fmt.Sprintf(`</%s></%s>`, code, pre)
+				}
+
+				return fmt.Sprintf(`</%s>`, pre)
+			},
+		}
+	}
+}
+
 // WrapLongLines wraps long lines.
 func WrapLongLines(b bool) Option {
 	return func(f *Formatter) {
@@ -77,6 +215,155 @@ func WrapLongLines(b bool) Option {
 	}
 }
 
+// WrapLines wraps only the lines within the given inclusive ranges, such as
+// long comment banners, while the rest scroll. It overrides WrapLongLines.
+func WrapLines(ranges [][2]int) Option {
+	return func(f *Formatter) {
+		f.wrapLines = ranges
+	}
+}
+
+// WrapIndent indents the continuation rows of lines wrapped by WrapLongLines
+// or WrapLines by size, a CSS length (eg. "4ch"), so they can be told apart
+// from the following lines. It is a hanging indent on the code of each line,
+// which is unaffected by line numbers.
+func WrapIndent(size string) Option {
+	return func(f *Formatter) {
+		f.wrapIndent = size
+	}
+}
+
+// ContentVisibilityAuto applies content-visibility:auto to each line, so
+// browsers can skip rendering offscreen lines of very large code blocks.
+func ContentVisibilityAuto(b bool) Option {
+	return func(f *Formatter) {
+		f.contentVisibilityAuto = b
+	}
+}
+
+// WithClasses replaces the utilities of each token type with a semantic class
+// named after it (eg. "chroma-k" for chroma.Keyword, and "chroma" for the
+// <pre>, both carrying the ClassPrefix), defined by the stylesheet written by
+// WriteCSS or the plugin written by WritePlugin. Unlike SharedClasses
+// the names do not depend on the style, so the HTML can be stored and the
+// stylesheet swapped.
+func WithClasses(b bool) Option {
+	return func(f *Formatter) {
+		f.withClasses = b
+	}
+}
+
+// SharedClasses replaces the utilities on each element with a short class name
+// (eg. "c1") assigned by registry. Formatters sharing a registry share names,
+// and the registry's WriteCSS defines them once for the whole page.
+func SharedClasses(registry *ClassRegistry) Option {
+	return func(f *Formatter) {
+		f.sharedClasses = registry
+	}
+}
+
+// IndentGuides draws a vertical guide for each level of leading indentation,
+// where a level is TabWidth columns (default 8) wide.
+func IndentGuides(b bool) Option {
+	return func(f *Formatter) {
+		f.indentGuides = b
+	}
+}
+
+// FlagMixedIndent wraps leading indentation that mixes tabs and spaces in a
+// span with the given class (eg. "bg-red-200"), to point out lines violating
+// style guides.
+func FlagMixedIndent(class string) Option {
+	return func(f *Formatter) {
+		f.flagMixedIndent = class
+	}
+}
+
+// BackgroundAlpha renders the backgrounds of highlighted lines and of inserted
+// and deleted diff lines at the given opacity, as a percentage, so they overlay
+// the code background rather than replacing it, eg. "bg-[#dedede]/20". This
+// applies to both the light and dark styles, but not to the colours of
+// TokenColorVariables. The default of 100 leaves them opaque.
+func BackgroundAlpha(percent int) Option {
+	return func(f *Formatter) {
+		f.backgroundAlpha = percent
+	}
+}
+
+// MaxLines collapses blocks of more than n lines to about n lines high, with a
+// control below them to expand them. This is done in CSS, with a <details>
+// element and the peer-open variant, so no script is needed.
+func MaxLines(n int) Option {
+	return func(f *Formatter) {
+		f.maxLines = n
+	}
+}
+
+// DimUnhighlighted adds class (eg. "opacity-50") to the lines outside every
+// HighlightLines range and HighlightGroup, fading the rest of the code to
+// draw attention to the highlighted lines. It has no effect without
+// highlights.
+func DimUnhighlighted(class string) Option {
+	return func(f *Formatter) {
+		f.dimUnhighlighted = class
+	}
+}
+
+// MergeWhitespace merges consecutive whitespace tokens of the Text category
+// on a line, which lexers often emit in runs, into a single token. The text is
+// unchanged.
+func MergeWhitespace(b bool) Option {
+	return func(f *Formatter) {
+		f.mergeWhitespace = b
+	}
+}
+
+// IndentClass wraps the leading indentation of each non-blank line in a span
+// with class (eg. "indent"), eg. to style indent guides. It is ignored with
+// FlagMixedIndent or IndentGuides.
+func IndentClass(class string) Option {
+	return func(f *Formatter) {
+		f.indentClass = class
+	}
+}
+
+// FocusTransition applies transition utilities (eg. "transition-[filter,opacity]
+// duration-300") to every line, so that changes to the dimming of lines, such
+// as revealing them on group-hover, are animated.
+func FocusTransition(class string) Option {
+	return func(f *Formatter) {
+		f.focusTransition = class
+	}
+}
+
+// TokenColorVariables makes tokens take their text and background colours
+// from CSS variables per token type (eg. "text-[color:var(--t-k)]" and
+// "bg-[color:var(--t-bg-bg)]"), defined for each theme with WriteVariables. The
+// same markup can then be shown in any number of themes by swapping the
+// variable definitions, eg. under [data-theme="solarized"].
+func TokenColorVariables(b bool) Option {
+	return func(f *Formatter) {
+		f.tokenColorVariables = b
+	}
+}
+
+// NeutralDark makes code legible in dark mode without a dark style, by
+// resetting token colours to inherit in dark mode and giving the block the
+// NeutralDarkBackground. It has no effect when WithDarkStyle is used.
+func NeutralDark(b bool) Option {
+	return func(f *Formatter) {
+		f.neutralDark = b
+	}
+}
+
+// NeutralDarkBackground sets the dark mode background utility used by
+// NeutralDark. Defaults to "bg-neutral-900".
+func NeutralDarkBackground(class string) Option {
+	return func(f *Formatter) {
+		f.neutralDarkBackground = class
+	}
+}
+
 // WithLineNumbers formats output with line numbers.
 func WithLineNumbers(b bool) Option {
 	return func(f *Formatter) {
@@ -84,272 +371,2650 @@ func WithLineNumbers(b bool) Option {
 	}
 }
 
-// LineNumbersInTable will, when combined with WithLineNumbers, separate the line numbers
-// and code in table td's, which make them copy-and-paste friendly.
-func LineNumbersInTable(b bool) Option {
+// LineNumberStep shows only the first line number and those that are multiples
+// of n, eg. 1, 5, 10 and so on for 5. The other lines keep their empty gutter
+// entries, and their ids with WithLinkableLineNumbers. Values of n up to 1 show
+// every line number.
+func LineNumberStep(n int) Option {
 	return func(f *Formatter) {
-		f.lineNumbersInTable = b
+		f.lineNumberStep = n
 	}
 }
 
-// WithLinkableLineNumbers decorates the line numbers HTML elements with an "id"
-// attribute so they can be linked.
-func WithLinkableLineNumbers(b bool, prefix string) Option {
+// DualLineNumbers shows separate old and new line numbers, as for a unified
+// diff, in place of those of WithLineNumbers. With LineNumbersInTable they form
+// two columns, and otherwise precede each line.
+//
+// mapping returns the positions of a line in the old and new files, counting
+// from 1, or 0 where the line is absent from that side, in which case its
+// number is left blank. Positions are offset by oldBase and newBase
+// respectively, the numbers of the first line of each side.
+func DualLineNumbers(oldBase, newBase int, mapping func(line int) (old, new int)) Option {
 	return func(f *Formatter) {
-		f.linkableLineNumbers = b
-		f.lineNumbersIDPrefix = prefix
+		f.dualLineBases = [2]int{oldBase, newBase}
+		f.dualLineNumbers = mapping
 	}
 }
 
-// HighlightLines higlights the given line ranges with the Highlight style.
-//
-// A range is the beginning and ending of a range as 1-based line numbers, inclusive.
-func HighlightLines(ranges [][2]int) Option {
+// DiffMarkers prefixes lines whose dominant token type is GenericInserted or
+// GenericDeleted, as produced by the diff lexer, with a "+" or "-" glyph in the
+// colours of that type. The glyphs are excluded from selection, so copying the
+// code leaves them out. With LineNumbersInTable they form a column of their
+// own, next to the code. Output without such lines is unaffected.
+func DiffMarkers(b bool) Option {
 	return func(f *Formatter) {
-		f.highlightRanges = ranges
-		sort.Sort(f.highlightRanges)
+		f.diffMarkers = b
 	}
 }
 
-// BaseLineNumber sets the initial number to start line numbering at. Defaults to 1.
-func BaseLineNumber(n int) Option {
+// DiffMarkerGlyphs replaces the "+" and "-" glyphs of DiffMarkers.
+func DiffMarkerGlyphs(inserted, deleted string) Option {
 	return func(f *Formatter) {
-		f.baseLineNumber = n
+		f.diffMarkerGlyphs = [2]string{inserted, deleted}
 	}
 }
 
-// New Tailwind formatter.
-func New(options ...Option) *Formatter {
-	f := &Formatter{
-		baseLineNumber: 1,
-		preWrapper:     defaultPreWrapper,
+// WithClassTransformer rewrites every emitted class with fn, eg. to replace
+// arbitrary colours with the design tokens of a preset. Classes mapped to ""
+// are dropped. Classes are passed to fn after ClassPrefix has been applied.
+func WithClassTransformer(fn func(class string) string) Option {
+	return func(f *Formatter) {
+		f.classTransformer = fn
 	}
-	f.classCache = newClassCache(f)
-	for _, option := range options {
-		option(f)
+}
+
+// CodePadding sets padding utilities (eg. "p-4") for the element containing the
+// code. In table mode only the code column is padded, so use horizontal padding
+// (eg. "px-4") to keep it aligned with the line numbers.
+func CodePadding(class string) Option {
+	return func(f *Formatter) {
+		f.codePadding = class
 	}
-	return f
 }
 
-// PreWrapper defines the operations supported in WithPreWrapper.
-type PreWrapper interface {
-	// Start is called to write a start <pre> element.
-	// The code flag tells whether this block surrounds
-	// highlighted code. This will be false when surrounding
-	// line numbers.
-	Start(code bool, classAttr string) string
+// WithTableClasses replaces the base classes of the <table> and of its <td>
+// cells in table mode, which default to removing borders, spacing and padding.
+// An empty string keeps the default.
+func WithTableClasses(table, td string) Option {
+	return func(f *Formatter) {
+		f.tableClasses = table
+		f.tableCellClasses = td
+	}
+}
 
-	// End is called to write the end </pre> element.
-	End(code bool) string
+// CompactGutter halves the padding and margin of the line number column in
+// table mode, for dense listings.
+func CompactGutter(b bool) Option {
+	return func(f *Formatter) {
+		f.compactGutter = b
+	}
 }
 
-type preWrapper struct {
-	start func(code bool, classAttr string) string
-	end   func(code bool) string
+// AsGroup makes the code block a Tailwind group, and each line a named group
+// ("group/line") and a peer, so that CSS-only hover affordances can be built
+// with variants such as group-hover: and group-hover/line:.
+func AsGroup(b bool) Option {
+	return func(f *Formatter) {
+		f.asGroup = b
+	}
 }
 
-func (p preWrapper) Start(code bool, classAttr string) string {
-	return p.start(code, classAttr)
+// FlatLines renders each line as a single <span> directly containing its
+// tokens, rather than a flex container of the line number and a code span.
+// The simpler markup pastes better into rich text editors.
+func FlatLines(b bool) Option {
+	return func(f *Formatter) {
+		f.flatLines = b
+	}
 }
 
-func (p preWrapper) End(code bool) string {
-	return p.end(code)
+// WithRowClass adds classes to the <tr> of the table in table mode.
+func WithRowClass(classes string) Option {
+	return func(f *Formatter) {
+		f.rowClass = classes
+	}
 }
 
-var (
-	nopPreWrapper = preWrapper{
-		start: func(code bool, classAttr string) string { return "" },
-		end:   func(code bool) string { return "" },
+// WithOuterDivClass adds classes (eg. "rounded-lg overflow-x-auto") to the
+// <div> wrapping the table in table mode.
+func WithOuterDivClass(classes string) Option {
+	return func(f *Formatter) {
+		f.outerDivClass = classes
 	}
-	defaultPreWrapper = preWrapper{
-		start: func(code bool, classAttr string) string {
-			if code {
-				return fmt.Sprintf(`<pre%s><code>`, classAttr)
-			}
+}
 
-			return fmt.Sprintf(`<pre%s>`, classAttr)
-		},
-		end: func(code bool) string {
-			if code {
-				return `</code></pre>`
-			}
+// MinimalPlainOutput writes the tokens of each line directly into the <pre>,
+// without the Line and CodeLine elements wrapping each line, when no options
+// that apply to individual lines, such as line numbers or highlights, are set.
+// This reduces the size of the output for simple snippets. With FlatLines, it
+// also omits the Line element of each line that would carry no classes or
+// attributes.
+func MinimalPlainOutput(b bool) Option {
+	return func(f *Formatter) {
+		f.minimalPlainOutput = b
+	}
+}
 
-			return `</pre>`
-		},
+// CodeColumnClass sets the classes of the code cell in table mode, replacing
+// the default "w-full".
+func CodeColumnClass(classes string) Option {
+	return func(f *Formatter) {
+		f.codeColumnClass = classes
 	}
-)
+}
 
-// Formatter that generates Tailwind HTML.
-type Formatter struct {
-	classCache            *classCache
-	standalone            bool
-	prefix                string
-	darkStyle             *chroma.Style
-	preWrapper            PreWrapper
-	inlineCode            bool
-	preventSurroundingPre bool
-	tabWidth              int
-	wrapLongLines         bool
-	lineNumbers           bool
-	lineNumbersInTable    bool
-	linkableLineNumbers   bool
-	lineNumbersIDPrefix   string
-	highlightRanges       highlightRanges
-	baseLineNumber        int
+// ShrinkCodeColumn omits the CodeColumnClass of the code cell in table mode, so
+// that the table is sized to its content rather than filling the available
+// width.
+func ShrinkCodeColumn(b bool) Option {
+	return func(f *Formatter) {
+		f.shrinkCodeColumn = b
+	}
 }
 
-type highlightRanges [][2]int
+// BlockLineNumbers renders each entry of the line number column in table mode
+// as a block element, rather than separating them with newlines, so rows stay
+// aligned with the code regardless of how newlines are handled.
+func BlockLineNumbers(b bool) Option {
+	return func(f *Formatter) {
+		f.blockLineNumbers = b
+	}
+}
 
-func (h highlightRanges) Len() int           { return len(h) }
-func (h highlightRanges) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-func (h highlightRanges) Less(i, j int) bool { return h[i][0] < h[j][0] }
+// LineNumbersInTable will, when combined with WithLineNumbers, separate the line numbers
+// and code in table td's, which make them copy-and-paste friendly.
+func LineNumbersInTable(b bool) Option {
+	return func(f *Formatter) {
+		f.lineNumbersInTable = b
+	}
+}
 
-func (f *Formatter) Format(w io.Writer, style *chroma.Style, iterator chroma.Iterator) (err error) {
-	return f.writeHTML(w, style, iterator.Tokens())
+// LineNumbersRight places the line numbers after the code rather than before
+// it, eg. for right-to-left layouts.
+func LineNumbersRight(b bool) Option {
+	return func(f *Formatter) {
+		f.lineNumbersRight = b
+	}
 }
 
-// We deliberately don't use html/template here because it is two orders of magnitude slower (benchmarked).
-//
-// OTOH we need to be super careful about correct escaping...
-func (f *Formatter) writeHTML(w io.Writer, style *chroma.Style, tokens []chroma.Token) (err error) { // nolint: gocyclo
-	classes := f.classCache.get(style, f.darkStyle)
-	if f.standalone {
-		fmt.Fprint(w, "<html>\n")
-		fmt.Fprintf(w, "<body%s>\n", f.classAttr(classes, chroma.Background))
+// WithLinkableLineNumbers decorates the line numbers HTML elements with an "id"
+// attribute so they can be linked.
+func WithLinkableLineNumbers(b bool, prefix string) Option {
+	return func(f *Formatter) {
+		f.linkableLineNumbers = b
+		f.lineNumbersIDPrefix = prefix
+	}
+}
+
+// Minify omits the newlines the formatter writes between elements outside of
+// the code, such as around table cells and the tags of a standalone document.
+// Newlines within the code are kept.
+func Minify(b bool) Option {
+	return func(f *Formatter) {
+		f.minify = b
+	}
+}
+
+// WithCaption wraps the code in a <figure> with a <figcaption> showing label,
+// eg. a language or filename, above the scrolling <pre> and in the colours of
+// the style. It has no effect in standalone mode or without the <pre>.
+func WithCaption(label string) Option {
+	return func(f *Formatter) {
+		f.caption = label
+	}
+}
+
+// CaptionClass sets the classes of the WithCaption caption, added to the
+// colours of the style. Defaults to "px-4 py-2 text-sm font-semibold".
+func CaptionClass(classes string) Option {
+	return func(f *Formatter) {
+		f.captionClass = classes
+	}
+}
+
+// captioned reports whether the code is wrapped in a figure with WithCaption.
+func (f *Formatter) captioned() bool {
+	return f.caption != "" && !f.standalone && !(f.preventSurroundingPre || f.inlineCode)
+}
+
+// WithCopyButton adds a button over the code in standalone mode which copies
+// the source to the clipboard, using a small inline script. It has no effect
+// without Standalone.
+func WithCopyButton(b bool) Option {
+	return func(f *Formatter) {
+		f.copyButton = b
+	}
+}
+
+// WithNonce adds a nonce attribute to inline <script> elements, such as that
+// of WithCopyButton, for a Content-Security-Policy.
+func WithNonce(nonce string) Option {
+	return func(f *Formatter) {
+		f.nonce = nonce
+	}
+}
+
+// WithLineAnchors makes line numbers linkable, as WithLinkableLineNumbers, but
+// with the id of each line and the href of its link returned by fn, eg.
+// "file-main-go-L42" and "#file-main-go-L42". The id is written as given, so it
+// must be unique within the page.
+func WithLineAnchors(fn func(line int) (id, href string)) Option {
+	return func(f *Formatter) {
+		f.linkableLineNumbers = true
+		f.lineAnchors = fn
+	}
+}
+
+// WithHighlightTOC writes a list of links to the first line of each range of
+// HighlightLines before the code. It requires WithLineNumbers and
+// WithLinkableLineNumbers.
+func WithHighlightTOC(b bool) Option {
+	return func(f *Formatter) {
+		f.highlightTOC = b
+	}
+}
+
+// HighlightTOCClass sets the classes of the list written by WithHighlightTOC.
+func HighlightTOCClass(class string) Option {
+	return func(f *Formatter) {
+		f.highlightTOCClass = class
+	}
+}
+
+// HighlightTOCLabel sets the function labelling the links written by
+// WithHighlightTOC, given the first and last lines of a range. Defaults to
+// "Line N" or "Lines N–M".
+func HighlightTOCLabel(label func(start, end int) string) Option {
+	return func(f *Formatter) {
+		f.highlightTOCLabel = label
+	}
+}
+
+// LineLinkRel sets the rel attribute of the links generated for
+// WithLinkableLineNumbers.
+func LineLinkRel(rel string) Option {
+	return func(f *Formatter) {
+		f.lineLinkRel = rel
+	}
+}
+
+// LineLinkTarget sets the target attribute of the links generated for
+// WithLinkableLineNumbers.
+func LineLinkTarget(target string) Option {
+	return func(f *Formatter) {
+		f.lineLinkTarget = target
+	}
+}
+
+// HighlightLines higlights the given line ranges with the Highlight style.
+//
+// A range is the beginning and ending of a range as 1-based line numbers, inclusive.
+// An ending of -1, or 0 unless lines are numbered from 0, extends the range to
+// the last line.
+func HighlightLines(ranges [][2]int) Option {
+	return func(f *Formatter) {
+		f.highlightRanges = ranges
+		sort.Sort(f.highlightRanges)
+	}
+}
+
+// Span is a range of columns within a line, for HighlightSpans.
+type Span struct {
+	// Line is the line number, as for HighlightLines.
+	Line int
+	// Start and End are 1-based columns, inclusive. Tabs are expanded to the
+	// TabWidth.
+	Start, End int
+}
+
+// HighlightSpans highlights the given column ranges within lines with the
+// Highlight style, splitting tokens where needed. Spans within lines highlighted
+// by HighlightLines are not highlighted again.
+func HighlightSpans(spans []Span) Option {
+	return func(f *Formatter) {
+		f.highlightSpans = map[int][]Span{}
+		for _, span := range spans {
+			f.highlightSpans[span.Line] = append(f.highlightSpans[span.Line], span)
+		}
+	}
+}
+
+// PrintColors adds print: variants keeping the code legible when printed:
+// dark text, from the light style with its colours darkened where needed, on
+// a transparent background. They take precedence over the dark: variants, as
+// browsers may print in dark mode.
+func PrintColors(b bool) Option {
+	return func(f *Formatter) {
+		f.printColors = b
+	}
+}
+
+// CanonicalColors writes every colour of the style in one form, lowercase
+// #rrggbb, so that styles written differently share classes. Shorthand is
+// expanded and an opaque alpha channel, as in #rrggbbff, dropped. It also
+// applies to the result of ColorSerializer, where it is a hex colour.
+func CanonicalColors(b bool) Option {
+	return func(f *Formatter) {
+		f.canonicalColors = b
+	}
+}
+
+// MinContrast replaces the text colour of each token type whose WCAG contrast
+// ratio (eg. 4.5) with its background is below ratio by black or white,
+// whichever contrasts better. Tokens without a background of their own are
+// checked against both the code background and the LineHighlight background.
+// Light and dark styles are checked separately. By default colours are kept
+// as the style has them.
+func MinContrast(ratio float64) Option {
+	return func(f *Formatter) {
+		f.minContrast = ratio
+	}
+}
+
+// ColorSerializer serializes the colours of the style with fn in place of
+// their "#rrggbb" form, eg. to use rgb() or oklch() notation, or to round
+// colours. The result is embedded inside the brackets of text-[...] and
+// bg-[...] as-is, except that whitespace is written as underscores, and is
+// used by WriteVariables too.
+func ColorSerializer(fn func(chroma.Colour) string) Option {
+	return func(f *Formatter) {
+		f.colorSerializer = fn
+	}
+}
+
+// PaletteColors uses the nearest colour of the default Tailwind palette (eg.
+// "text-violet-600") in place of each arbitrary colour of the style (eg.
+// "text-[#6f42c1]"), unless the nearest colour differs by more than the
+// PaletteMaxDistance.
+func PaletteColors(b bool) Option {
+	return func(f *Formatter) {
+		f.paletteColors = b
+	}
+}
+
+// PaletteMaxDistance sets the largest difference, as CIELAB ΔE, for which
+// PaletteColors replaces a colour with a palette colour. Defaults to 10.
+func PaletteMaxDistance(distance float64) Option {
+	return func(f *Formatter) {
+		f.paletteMaxDistance = distance
+	}
+}
+
+// ErrorTooltips marks tokens the lexer could not tokenise (chroma.Error) with a
+// wavy underline and a title explaining it, set with ErrorTooltipText.
+func ErrorTooltips(b bool) Option {
+	return func(f *Formatter) {
+		f.errorTooltips = b
+	}
+}
+
+// ErrorTooltipText sets the title of tokens marked by ErrorTooltips. Defaults
+// to "unexpected input".
+func ErrorTooltipText(text string) Option {
+	return func(f *Formatter) {
+		f.errorTooltipText = text
+	}
+}
+
+// HighlightTokenTypes adds class (eg. "underline") to every token of one of
+// types, or of a subtype of one, so that chroma.Name matches all names.
+func HighlightTokenTypes(types []chroma.TokenType, class string) Option {
+	return func(f *Formatter) {
+		f.highlightTokenTypes = types
+		f.highlightTokenTypesClass = class
+	}
+}
+
+// BoldClass sets the font weight utility (eg. "font-semibold") given to bold
+// tokens, "font-bold" by default. An empty class leaves bold tokens at the
+// normal weight, eg. for fonts without a bold face.
+func BoldClass(class string) Option {
+	return func(f *Formatter) {
+		f.boldClass = class
+	}
+}
+
+// SuppressEmphasis omits the italic and underline utilities of the style, so
+// tokens are only distinguished by colour and weight.
+func SuppressEmphasis(b bool) Option {
+	return func(f *Formatter) {
+		f.suppressEmphasis = b
+	}
+}
+
+// DimComments de-emphasises comments with "opacity-70", as many editor themes
+// do. See DimTokens to dim other tokens or change the opacity.
+func DimComments(b bool) Option {
+	return func(f *Formatter) {
+		if b {
+			f.dimType, f.dimClass = chroma.Comment, "opacity-70"
+		} else {
+			f.dimClass = ""
+		}
+	}
+}
+
+// DimTokens adds class (eg. "opacity-60") to tokens of type tt or its
+// subtypes, to de-emphasise them.
+func DimTokens(tt chroma.TokenType, class string) Option {
+	return func(f *Formatter) {
+		f.dimType, f.dimClass = tt, class
+	}
+}
+
+// HighlightAnchors gives the first line of each HighlightLines range an id of
+// prefix followed by the number of the range, counting from 1, so that eg.
+// "#hl-1" links to the first range. The anchored lines have a scroll margin,
+// set with HighlightAnchorClass, to clear any sticky header.
+func HighlightAnchors(prefix string) Option {
+	return func(f *Formatter) {
+		f.highlightAnchors = prefix
+	}
+}
+
+// HighlightAnchorClass sets the classes of lines with a HighlightAnchors id.
+// Defaults to "scroll-mt-4".
+func HighlightAnchorClass(class string) Option {
+	return func(f *Formatter) {
+		f.highlightAnchorClass = class
+	}
+}
+
+// HighlightTokenFunc calls fn for each token along with its line number. When
+// fn returns ok, the returned class (eg. "line-through") is added to the token.
+func HighlightTokenFunc(fn func(token chroma.Token, line int) (class string, ok bool)) Option {
+	return func(f *Formatter) {
+		f.highlightTokenFunc = fn
+	}
+}
+
+// HighlightGroup highlights the given line ranges with class (eg.
+// "bg-red-100"), as a named group such as "error" or "warning". The class is
+// applied to both the code and, in table mode, the line numbers, so that one
+// block can mark ranges as eg. added and changed.
+//
+// It may be given multiple times. Where the ranges of groups overlap, the group
+// given last takes precedence.
+func HighlightGroup(name string, ranges [][2]int, class string) Option {
+	return func(f *Formatter) {
+		f.highlightGroups = append(f.highlightGroups, highlightGroup{name: name, ranges: ranges, class: class})
+	}
+}
+
+// HighlightLabel sets the text announced to screen readers for lines
+// highlighted by the HighlightGroup named group, or by HighlightLines if group
+// is "". It defaults to the name of the group, or "highlighted". Labels are
+// only written with Accessible.
+func HighlightLabel(group, label string) Option {
+	return func(f *Formatter) {
+		if f.highlightLabels == nil {
+			f.highlightLabels = map[string]string{}
+		}
+		f.highlightLabels[group] = label
+	}
+}
+
+// HighlightWhere highlights the lines within ranges for which pred, given the
+// tokens of the line, returns true, with class (eg. "bg-yellow-100"). It may be
+// given multiple times.
+func HighlightWhere(ranges [][2]int, pred func(lineTokens []chroma.Token) bool, class string) Option {
+	return func(f *Formatter) {
+		f.highlightWheres = append(f.highlightWheres, highlightWhere{ranges: ranges, pred: pred, class: class})
+	}
+}
+
+// BaseLineNumber sets the initial number to start line numbering at. Defaults to 1.
+func BaseLineNumber(n int) Option {
+	return func(f *Formatter) {
+		f.baseLineNumber = n
+		f.baseLineNumberSet = true
+	}
+}
+
+// OmitPlainSpans emits plain text tokens as bare escaped text when their classes
+// add nothing over what the surrounding block already provides.
+func OmitPlainSpans(b bool) Option {
+	return func(f *Formatter) {
+		f.omitPlainSpans = b
+	}
+}
+
+// WrapOnly restricts span wrapping to tokens of the given types (or their
+// sub-types). All other tokens are emitted as bare escaped text.
+func WrapOnly(types ...chroma.TokenType) Option {
+	return func(f *Formatter) {
+		f.wrapOnly = types
+	}
+}
+
+// LineWindows restricts output to the given inclusive line ranges, with a gap
+// marker rendered between windows that aren't contiguous. See ParseLineRanges
+// for building windows from a string such as "10-20,30-35".
+func LineWindows(windows [][2]int) Option {
+	return func(f *Formatter) {
+		f.lineWindows = mergeRanges(windows)
+	}
+}
+
+// GapMarker sets the text (default "⋯") and additional classes of the full
+// width separator rendered between discontiguous LineWindows. The separator
+// has no line number.
+func GapMarker(text, class string) Option {
+	return func(f *Formatter) {
+		f.gapMarker = text
+		f.gapMarkerClass = class
+	}
+}
+
+// ZeroBasedLines numbers lines from 0 rather than 1.
+//
+// Line numbers, HighlightLines, LineWindows and linkable line anchors then all
+// refer to the first line as 0. An explicit BaseLineNumber still takes
+// precedence, and all of these continue to use the numbers as displayed.
+func ZeroBasedLines(b bool) Option {
+	return func(f *Formatter) {
+		f.zeroBasedLines = b
+	}
+}
+
+// TokenNameAttribute adds a data-token attribute holding chroma's short token
+// name (eg. "k" for keywords) to each token span.
+func TokenNameAttribute(b bool) Option {
+	return func(f *Formatter) {
+		f.tokenNameAttribute = b
+	}
+}
+
+// AssumeEscaped writes token text as is, for tokens whose text is already
+// HTML-escaped, such as when re-highlighting stored HTML. InsertWordBreaks is
+// ignored.
+//
+// This is unsafe unless the input is trusted and correctly escaped, as it
+// allows arbitrary markup into the output.
+func AssumeEscaped(b bool) Option {
+	return func(f *Formatter) {
+		f.assumeEscaped = b
+	}
+}
+
+// WithThemeName records the names of the light and dark themes in
+// data-theme-light and data-theme-dark attributes of the outermost code
+// element, for client-side theme switchers. Empty names are omitted.
+func WithThemeName(light, dark string) Option {
+	return func(f *Formatter) {
+		f.themeNames = [2]string{light, dark}
+	}
+}
+
+// WithTokenElements renders tokens of the given types, and their subtypes,
+// using the mapped element (eg. "em" for chroma.Comment) rather than <span>,
+// keeping their classes.
+//
+// Panics if an element is not a simple element name.
+func WithTokenElements(elements map[chroma.TokenType]string) Option {
+	for _, element := range elements {
+		if !wrapperTagRe.MatchString(element) {
+			panic(fmt.Sprintf("tailwind: invalid token element %q", element))
+		}
+	}
+	return func(f *Formatter) {
+		f.tokenElements = elements
+	}
+}
+
+// WithCustomClasses adds classes to tokens of the given types, and their
+// subtypes, after the colour classes, eg. "font-mono" for
+// chroma.LiteralString. The most specific type in the map wins. Structural
+// types such as chroma.Background and chroma.PreWrapper only match exactly.
+func WithCustomClasses(classes map[chroma.TokenType][]string) Option {
+	return func(f *Formatter) {
+		f.customClasses = classes
+	}
+}
+
+// MergeAdjacentTokens writes consecutive tokens on a line that would have
+// identical elements and attributes as a single element, reducing the size of
+// the output. The visible output is unchanged. Enabled by default; disable it
+// to keep an element per token, eg. for scripts inspecting tokens.
+func MergeAdjacentTokens(b bool) Option {
+	return func(f *Formatter) {
+		f.mergeAdjacentTokens = b
+	}
+}
+
+// TokenTitles adds a title attribute naming the token type (eg. "Keyword") to
+// each token, so hovering reveals how the lexer categorised it. Every token is
+// wrapped in a span, including unstyled ones.
+func TokenTitles(b bool) Option {
+	return func(f *Formatter) {
+		f.tokenTitles = b
+	}
+}
+
+// ShowWhitespace marks tokens consisting of spaces and tabs with class, so
+// that whitespace can be visualised (eg. "bg-red-100/50"). Such tokens are
+// always wrapped in a span, even with OmitPlainSpans.
+func ShowWhitespace(class string) Option {
+	return func(f *Formatter) {
+		f.showWhitespace = class
+	}
+}
+
+// TokenPositionData adds data-start and data-end attributes to each token,
+// holding the byte offsets of the token in the source, so that positions in
+// the rendered code can be mapped back to the source. Every token is wrapped in
+// a span, including unstyled ones.
+func TokenPositionData(b bool) Option {
+	return func(f *Formatter) {
+		f.tokenPositionData = b
+	}
+}
+
+// ScrollSnap makes the code block a horizontal scroll-snap container. Snap
+// points are placed on the first line and on the first line of each range
+// given to HighlightLines.
+func ScrollSnap(b bool) Option {
+	return func(f *Formatter) {
+		f.scrollSnap = b
+	}
+}
+
+// SeparateThemeClasses omits dark: variants from the output, rendering only the
+// light style's classes. Use ThemeClasses to obtain the class lists for each
+// theme so they can be swapped client side.
+func SeparateThemeClasses(b bool) Option {
+	return func(f *Formatter) {
+		f.separateThemeClasses = b
+	}
+}
+
+// LinesAsListItems renders the code as an unstyled <ol> with one <li> per line,
+// so that copying into rich text editors preserves the line structure.
+func LinesAsListItems(b bool) Option {
+	return func(f *Formatter) {
+		f.linesAsListItems = b
+	}
+}
+
+// LineNumbersAsList renders numbered lines as an <ol> with one <li> per line,
+// with a value attribute giving its line number, so that screen readers can
+// announce and navigate the lines as a list. The line numbers are shown as
+// with WithLineNumbers, so highlights and WithLinkableLineNumbers still apply.
+// It has no effect without WithLineNumbers, or with LineNumbersInTable.
+func LineNumbersAsList(b bool) Option {
+	return func(f *Formatter) {
+		f.lineNumbersAsList = b
+	}
+}
+
+// listItems reports whether lines are rendered as items of an <ol>, with
+// LinesAsListItems or LineNumbersAsList.
+func (f *Formatter) listItems() bool {
+	if f.preventSurroundingPre || f.inlineCode {
+		return false
+	}
+	return f.linesAsListItems || (f.lineNumbersAsList && f.lineNumbers && !f.lineNumbersInTable)
+}
+
+// CacheByStyleName makes the class cache treat distinct *chroma.Style values
+// with the same name and entries as identical, so reconstructed styles share
+// cache entries. Styles without a name are still compared by identity.
+func CacheByStyleName(b bool) Option {
+	return func(f *Formatter) {
+		f.cacheByStyleName = b
+	}
+}
+
+// CacheMemoryBudget limits the estimated memory used by the class cache to
+// bytes, evicting the least recently used entries once it is exceeded. The most
+// recent entry is always kept. Zero means no limit beyond the entry count.
+func CacheMemoryBudget(bytes int) Option {
+	return func(f *Formatter) {
+		f.cacheMemoryBudget = bytes
+	}
+}
+
+// ClassCacheSize sets the number of compiled style pairs kept by the class
+// cache, defaulting to 32. Zero or less means the cache is unbounded, which
+// suits services rendering many distinct light and dark style combinations.
+func ClassCacheSize(n int) Option {
+	return func(f *Formatter) {
+		f.classCacheSize = n
+	}
+}
+
+// PrintBackground forces browsers to print the code block's themed background,
+// which they otherwise drop when printing.
+func PrintBackground(b bool) Option {
+	return func(f *Formatter) {
+		f.printBackground = b
+	}
+}
+
+// Layouts supported by HighlightLayout.
+const (
+	HighlightLayoutGrid  = "grid"
+	HighlightLayoutBlock = "block"
+)
+
+// Orders of the classes of an element, for ClassOrder.
+const (
+	// ClassOrderLayoutFirst lists layout utilities, then the theme's colours
+	// and font styles, then their dark: and print: variants, then the
+	// remaining options such as custom classes and tab size.
+	ClassOrderLayoutFirst = "layout-first"
+	// ClassOrderColourFirst lists the theme's colours and font styles and their
+	// variants, then layout utilities, then the remaining options such as
+	// custom classes and tab size.
+	ClassOrderColourFirst = "colour-first"
+)
+
+// ClassOrder sets the order of the classes on each element. Defaults to
+// ClassOrderLayoutFirst. Colours are ordered text, background, bold, italic,
+// underline, in both the theme's classes and their variants. The order only
+// depends on the options, so output is byte-stable for a given configuration.
+func ClassOrder(order string) Option {
+	return func(f *Formatter) {
+		f.classOrder = order
+	}
+}
+
+// Dark mode strategies, for DarkModeStrategy.
+const (
+	// DarkModeClass applies dark styles with the dark: variant, so they follow
+	// the dark mode strategy configured in the Tailwind project.
+	DarkModeClass = "class"
+	// DarkModeMedia applies dark styles with the arbitrary variant
+	// [@media(prefers-color-scheme:dark)]:, so they follow the system setting
+	// whether or not the project toggles a .dark class. Requires Tailwind 3.2
+	// or later.
+	DarkModeMedia = "media"
+)
+
+// DarkModeStrategy sets how dark styles are applied. Defaults to
+// DarkModeClass.
+func DarkModeStrategy(strategy string) Option {
+	return func(f *Formatter) {
+		f.darkModeStrategy = strategy
+	}
+}
+
+// HighlightLayout selects how full-width line highlights are laid out.
+//
+// HighlightLayoutGrid (the default) makes the code block a grid. With
+// HighlightLayoutBlock the block keeps normal flow and each line is made full
+// width instead.
+func HighlightLayout(mode string) Option {
+	return func(f *Formatter) {
+		f.highlightLayout = mode
+	}
+}
+
+// DarkBackgroundFallback derives a dark mode background for tokens that only
+// the light style gives a background, by tinting the dark style's background,
+// instead of making them transparent in dark mode.
+func DarkBackgroundFallback(b bool) Option {
+	return func(f *Formatter) {
+		f.darkBackgroundFallback = b
+	}
+}
+
+// Whitespace sets the whitespace utility (eg. "whitespace-pre") applied to the
+// code wrapper. Defaults to "whitespace-pre" for InlineCode and
+// PreventSurroundingPre, where there is no <pre> to preserve whitespace. With
+// PreventSurroundingPre, the code is wrapped in a <span> with just this
+// utility.
+func Whitespace(class string) Option {
+	return func(f *Formatter) {
+		f.whitespace = class
+	}
+}
+
+// HighlightAccent draws a coloured bar on the left edge of highlighted lines,
+// using the given border colour utility (eg. "border-amber-500"), in addition
+// to the highlight background.
+func HighlightAccent(class string) Option {
+	return func(f *Formatter) {
+		f.highlightAccent = class
+	}
+}
+
+// Accessible adds ARIA attributes describing the code block to the output.
+func Accessible(b bool) Option {
+	return func(f *Formatter) {
+		f.accessible = b
+	}
+}
+
+// WithLanguage sets the human readable name of the language being formatted,
+// eg. "Go", for use in generated labels.
+func WithLanguage(lang string) Option {
+	return func(f *Formatter) {
+		f.language = lang
+	}
+}
+
+// InsertWordBreaks inserts <wbr> break opportunities after punctuation and
+// inside long unbroken runs, for clients that can't wrap long lines with CSS.
+func InsertWordBreaks(b bool) Option {
+	return func(f *Formatter) {
+		f.insertWordBreaks = b
+	}
+}
+
+// LanguageContainerClass adds a "lang-<name>" class, derived from WithLanguage,
+// to the code container so CSS can target specific languages.
+func LanguageContainerClass(b bool) Option {
+	return func(f *Formatter) {
+		f.languageContainerClass = b
+	}
+}
+
+// WithMetaColumn adds a leading column of per-line metadata (eg. blame or
+// coverage) in table mode, rendering the escaped result of fn for each line.
+func WithMetaColumn(fn func(line int) string) Option {
+	return func(f *Formatter) {
+		f.metaColumn = fn
+	}
+}
+
+// SideAnnotations adds a trailing column of annotations in table mode, showing
+// the escaped note for each line in notes, if any, styled with class.
+func SideAnnotations(notes map[int]string, class string) Option {
+	return func(f *Formatter) {
+		f.sideAnnotations = notes
+		f.sideAnnotationClass = class
+	}
+}
+
+// WithPlainFallback follows the code block with a visually hidden <pre> of the
+// plain source, which remains readable and copyable if the stylesheet fails to
+// load. It has no effect with InlineCode.
+func WithPlainFallback(b bool) Option {
+	return func(f *Formatter) {
+		f.plainFallback = b
+	}
+}
+
+// HighlightViaGridRows draws each range of HighlightLines as a single element
+// placed behind the lines using grid rows, rather than adding the highlight to
+// every line, reducing the size of the DOM for large highlights. It has no
+// effect with HighlightLayoutBlock, LinesAsListItems, InlineCode or
+// PreventSurroundingPre.
+func HighlightViaGridRows(b bool) Option {
+	return func(f *Formatter) {
+		f.highlightViaGridRows = b
+	}
+}
+
+// HighlightDataAttribute marks highlighted lines with data-highlighted="true"
+// and data-highlight-range, the index of the containing range in ascending
+// order, for use by scripts. With LineNumbersInTable, the highlighted entries
+// of the gutter are marked too. See Accessible for announcing highlighted
+// lines to screen readers.
+func HighlightDataAttribute(b bool) Option {
+	return func(f *Formatter) {
+		f.highlightDataAttribute = b
+	}
+}
+
+// LineDataAttribute marks every line with data-line, its line number as
+// offset by BaseLineNumber, whether or not line numbers are shown, eg. to
+// address and measure lines in a virtualized viewport. With LineNumbersInTable,
+// the entries of the line number gutter are marked too.
+func LineDataAttribute(b bool) Option {
+	return func(f *Formatter) {
+		f.lineDataAttribute = b
+	}
+}
+
+// New Tailwind formatter.
+//
+// The formatter returned by formatters.Get("tailwind") is New() with no
+// options. To select a configured formatter by name, register it in place of
+// the default:
+//
+//	formatters.Register("tailwind", tailwind.New(tailwind.WithLineNumbers(true)))
+func New(options ...Option) *Formatter {
+	f := &Formatter{
+		baseLineNumber:        1,
+		preWrapper:            defaultPreWrapper,
+		neutralDarkBackground: "bg-neutral-900",
+		inlinePadding:         "px-1",
+		inlineRounding:        "rounded",
+		codeColumnClass:       "w-full",
+		gapMarker:             defaultGapMarker,
+		errorTooltipText:      "unexpected input",
+		paletteMaxDistance:    defaultPaletteMaxDistance,
+		highlightAnchorClass:  "scroll-mt-4",
+		captionClass:          "px-4 py-2 text-sm font-semibold",
+		classCacheSize:        classCacheLimit,
+		diffMarkerGlyphs:      [2]string{"+", "-"},
+		backgroundAlpha:       100,
+		standaloneLang:        "en",
+		boldClass:             "font-bold",
+		mergeAdjacentTokens:   true,
+	}
+	f.classCache = newClassCache(f)
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// PreWrapper defines the operations supported in WithPreWrapper.
+type PreWrapper interface {
+	// Start is called to write a start <pre> element.
+	// The code flag tells whether this block surrounds
+	// highlighted code. This will be false when surrounding
+	// line numbers.
+	Start(code bool, classAttr string) string
+
+	// End is called to write the end </pre> element.
+	End(code bool) string
+}
+
+// PreWrapperWithContext is a PreWrapper that is also told about the code it
+// surrounds, eg. to add data-lines and data-lang attributes. When the wrapper
+// passed to WithPreWrapper implements it, StartWithContext is called in place
+// of Start.
+type PreWrapperWithContext interface {
+	PreWrapper
+
+	// StartWithContext is called to write a start <pre> element, as Start.
+	StartWithContext(code bool, classAttr string, ctx PreContext) string
+}
+
+// PreContext describes the code surrounded by a PreWrapperWithContext.
+type PreContext struct {
+	// Lines is the number of lines, or -1 from WriteShell.
+	Lines int
+	// Language is the name set by WithLanguage, if any.
+	Language string
+}
+
+// preStart returns the start of the pre wrapper, passing the context to a
+// PreWrapperWithContext.
+func (f *Formatter) preStart(code bool, classAttr string, lines int) string {
+	if f.preservesWhitespace(code) {
+		// There is no wrapper to carry the whitespace utility.
+		return "<span" + f.utilityAttr(f.whitespaceClass()) + ">"
+	}
+	if wrapper, ok := f.preWrapper.(PreWrapperWithContext); ok {
+		return wrapper.StartWithContext(code, classAttr, PreContext{Lines: lines, Language: f.language})
+	}
+	return f.preWrapper.Start(code, classAttr)
+}
+
+// preEnd returns the closing markup matching preStart.
+func (f *Formatter) preEnd(code bool) string {
+	if f.preservesWhitespace(code) {
+		return "</span>"
+	}
+	return f.preWrapper.End(code)
+}
+
+// preservesWhitespace reports whether the code is wrapped in an element of its
+// own setting the Whitespace utility, with PreventSurroundingPre.
+func (f *Formatter) preservesWhitespace(code bool) bool {
+	return code && f.preventSurroundingPre && f.whitespaceClass() != ""
+}
+
+type preWrapper struct {
+	start func(code bool, classAttr string) string
+	end   func(code bool) string
+}
+
+func (p preWrapper) Start(code bool, classAttr string) string {
+	return p.start(code, classAttr)
+}
+
+func (p preWrapper) End(code bool) string {
+	return p.end(code)
+}
+
+var (
+	nopPreWrapper = preWrapper{
+		start: func(code bool, classAttr string) string { return "" },
+		end:   func(code bool) string { return "" },
+	}
+	defaultPreWrapper = preWrapper{
+		start: func(code bool, classAttr string) string {
+			if code {
+				return fmt.Sprintf(`<pre%s><code>`, classAttr)
+			}
+
+			return fmt.Sprintf(`<pre%s>`, classAttr)
+		},
+		end: func(code bool) string {
+			if code {
+				return `</code></pre>`
+			}
+
+			return `</pre>`
+		},
+	}
+)
+
+// Formatter that generates Tailwind HTML.
+type Formatter struct {
+	classCache               *classCache
+	standalone               bool
+	standaloneTitle          string
+	standaloneBodyClass      string
+	prefix                   string
+	darkStyle                *chroma.Style
+	preWrapper               PreWrapper
+	inlineCode               bool
+	preventSurroundingPre    bool
+	tabWidth                 int
+	tabWidthSet              bool
+	wrapLongLines            bool
+	lineNumbers              bool
+	lineNumbersInTable       bool
+	linkableLineNumbers      bool
+	lineNumbersIDPrefix      string
+	highlightRanges          highlightRanges
+	baseLineNumber           int
+	omitPlainSpans           bool
+	wrapOnly                 []chroma.TokenType
+	lineWindows              [][2]int
+	baseLineNumberSet        bool
+	zeroBasedLines           bool
+	tokenNameAttribute       bool
+	scrollSnap               bool
+	separateThemeClasses     bool
+	linesAsListItems         bool
+	cacheByStyleName         bool
+	printBackground          bool
+	highlightLayout          string
+	darkBackgroundFallback   bool
+	whitespace               string
+	highlightAccent          string
+	accessible               bool
+	language                 string
+	insertWordBreaks         bool
+	languageContainerClass   bool
+	metaColumn               func(line int) string
+	highlightDataAttribute   bool
+	highlightGroups          []highlightGroup
+	tokenTitles              bool
+	wrapLines                [][2]int
+	contentVisibilityAuto    bool
+	sharedClasses            *ClassRegistry
+	flagMixedIndent          string
+	focusTransition          string
+	neutralDark              bool
+	neutralDarkBackground    string
+	inlinePadding            string
+	inlineRounding           string
+	inlineCodeBare           bool
+	showWhitespace           string
+	cacheMemoryBudget        int
+	blockLineNumbers         bool
+	trimTrailingNewline      bool
+	trimTrailingNewlineSet   bool
+	dualLineNumbers          func(line int) (old, new int)
+	dualLineBases            [2]int
+	tokenColorVariables      bool
+	lineLinkRel              string
+	lineLinkTarget           string
+	codeColumnClass          string
+	assumeEscaped            bool
+	themeNames               [2]string
+	codePadding              string
+	highlightViaGridRows     bool
+	classTransformer         func(class string) string
+	nonPreWrapper            bool
+	highlightTOC             bool
+	highlightTOCClass        string
+	highlightTOCLabel        func(start, end int) string
+	tokenPositionData        bool
+	gapMarker                string
+	gapMarkerClass           string
+	tokenElements            map[chroma.TokenType]string
+	classOrder               string
+	highlightTokenFunc       func(token chroma.Token, line int) (class string, ok bool)
+	indentGuides             bool
+	highlightLabels          map[string]string
+	sideAnnotations          map[int]string
+	sideAnnotationClass      string
+	plainFallback            bool
+	tableClasses             string
+	tableCellClasses         string
+	highlightTokenTypes      []chroma.TokenType
+	highlightTokenTypesClass string
+	highlightWheres          []highlightWhere
+	dimType                  chroma.TokenType
+	dimClass                 string
+	compactGutter            bool
+	shrinkCodeColumn         bool
+	flatLines                bool
+	errorTooltips            bool
+	errorTooltipText         string
+	paletteColors            bool
+	paletteMaxDistance       float64
+	highlightAnchors         string
+	highlightAnchorClass     string
+	asGroup                  bool
+	rowClass                 string
+	outerDivClass            string
+	minimalPlainOutput       bool
+	customClasses            map[chroma.TokenType][]string
+	darkModeStrategy         string
+	mergeAdjacentTokens      bool
+	highlightSpans           map[int][]Span
+	lineAnchors              func(line int) (id, href string)
+	minify                   bool
+	lineNumbersAsList        bool
+	withClasses              bool
+	caption                  string
+	captionClass             string
+	copyButton               bool
+	nonce                    string
+	lineNumbersRight         bool
+	classCacheSize           int
+	dimUnhighlighted         string
+	diffMarkers              bool
+	diffMarkerGlyphs         [2]string
+	lineNumberStep           int
+	expandTabs               bool
+	backgroundAlpha          int
+	standaloneLang           string
+	standaloneHead           string
+	maxLines                 int
+	boldClass                string
+	suppressEmphasis         bool
+	mergeWhitespace          bool
+	indentClass              string
+	lineDataAttribute        bool
+	colorSerializer          func(chroma.Colour) string
+	minContrast              float64
+	printColors              bool
+	wrapIndent               string
+	canonicalColors          bool
+}
+
+type highlightRanges [][2]int
+
+type highlightGroup struct {
+	name   string
+	ranges [][2]int
+	class  string
+}
+
+type highlightWhere struct {
+	ranges [][2]int
+	pred   func(lineTokens []chroma.Token) bool
+	class  string
+}
+
+// withHighlightsEndingAt returns f, or a copy of it if any HighlightLines
+// ranges are open-ended, with those ranges ending at lastLine.
+func (f *Formatter) withHighlightsEndingAt(lastLine int) *Formatter {
+	// 0 is a line number when lines are numbered from 0.
+	openEnded := func(hrange [2]int) bool { return hrange[1] == -1 || (hrange[1] == 0 && f.firstLine() > 0) }
+	if !slices.ContainsFunc(f.highlightRanges, openEnded) {
+		return f
+	}
+	clone := *f
+	clone.highlightRanges = make(highlightRanges, len(f.highlightRanges))
+	for i, hrange := range f.highlightRanges {
+		if openEnded(hrange) {
+			hrange[1] = lastLine
+		}
+		clone.highlightRanges[i] = hrange
+	}
+	return &clone
+}
+
+func (h highlightRanges) Len() int           { return len(h) }
+func (h highlightRanges) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h highlightRanges) Less(i, j int) bool { return h[i][0] < h[j][0] }
+
+func (f *Formatter) Format(w io.Writer, style *chroma.Style, iterator chroma.Iterator) (err error) {
+	return f.FormatContext(context.Background(), w, style, iterator)
+}
+
+// contextCheckLines is the number of lines FormatContext renders between
+// checks of its context.
+const contextCheckLines = 64
+
+// FormatContext formats like Format, but stops once ctx is done, returning its
+// error. The context is checked every 64 lines, so the output is cut short
+// mid-document.
+func (f *Formatter) FormatContext(ctx context.Context, w io.Writer, style *chroma.Style, iterator chroma.Iterator) error {
+	if ctx.Done() == nil {
+		// The context can never be cancelled.
+		return f.writeIterator(w, style, iterator, nil)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.writeIterator(w, style, iterator, func(rendered int) error {
+		if rendered%contextCheckLines != 0 {
+			return nil
+		}
+		return ctx.Err()
+	})
+}
+
+// FormatString formats like Format, returning the HTML as a string.
+func (f *Formatter) FormatString(style *chroma.Style, iterator chroma.Iterator) (string, error) {
+	var out strings.Builder
+	err := f.Format(&out, style, iterator)
+	return out.String(), err
+}
+
+// FormatWithText formats like Format, and also returns the plain text of the
+// tokens, eg. for a search index.
+func (f *Formatter) FormatWithText(w io.Writer, style *chroma.Style, iterator chroma.Iterator) (plain string, err error) {
+	tokens := iterator.Tokens()
+	return tokensText(tokens), f.writeHTML(w, style, tokens, nil)
+}
+
+// FormatWithPrefix formats like Format, but with the given class prefix in
+// place of the ClassPrefix option. The classes of every prefix share the class
+// cache of the formatter, and its limits.
+func (f *Formatter) FormatWithPrefix(w io.Writer, prefix string, style *chroma.Style, iterator chroma.Iterator) error {
+	if prefix == f.prefix {
+		return f.Format(w, style, iterator)
+	}
+	return f.withPrefix(prefix).Format(w, style, iterator)
+}
+
+// withPrefix returns a copy of the formatter using prefix. It shares the
+// entries of the class cache, which are keyed by prefix.
+func (f *Formatter) withPrefix(prefix string) *Formatter {
+	clone := *f
+	clone.prefix = prefix
+	clone.classCache = &classCache{classStore: f.classCache.classStore, f: &clone}
+	return &clone
+}
+
+// FormatChunked formats like Format, but after every linesPerChunk lines the
+// output so far is flushed, if w has a Flush method, and onChunk is called with
+// the number of lines written. The last chunk is reported after the closing
+// tags have been written, so each chunk can be sent to a client as it is
+// completed.
+func (f *Formatter) FormatChunked(w io.Writer, style *chroma.Style, iterator chroma.Iterator, linesPerChunk int, onChunk func(n int) error) error {
+	if linesPerChunk <= 0 {
+		return fmt.Errorf("invalid chunk size %d", linesPerChunk)
+	}
+	chunk := func(n int) error {
+		if err := flush(w); err != nil {
+			return err
+		}
+		return onChunk(n)
+	}
+	total := 0
+	err := f.writeIterator(w, style, iterator, func(rendered int) error {
+		total = rendered + 1
+		if rendered > 0 && rendered%linesPerChunk == 0 {
+			return chunk(rendered)
+		}
+		return nil
+	})
+	if err != nil || total == 0 {
+		return err
+	}
+	return chunk(total)
+}
+
+// flush flushes w if it supports flushing, such as a *bufio.Writer or an
+// http.Flusher.
+func flush(w io.Writer) error {
+	switch w := w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Flush() }:
+		w.Flush()
+	}
+	return nil
+}
+
+// errWriter records the first error writing to w, after which writes are
+// skipped.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+func (e *errWriter) WriteString(s string) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := io.WriteString(e.w, s)
+	e.err = err
+	return n, err
+}
+
+// FormatLines renders each line and passes its HTML to fn, along with its line
+// number, instead of writing a complete code block. This allows lines to be
+// assembled by the caller, eg. for virtual lists or pagination. The block
+// wrappers are not rendered, and iteration stops at the first error from fn.
+func (f *Formatter) FormatLines(style *chroma.Style, iterator chroma.Iterator, fn func(lineNumber int, html string) error) error {
+	classes := f.classCache.get(style, f.darkStyle)
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+	firstLine := f.firstLine()
+	f = f.withHighlightsEndingAt(firstLine + len(lines) - 1)
+	layout := f.fragmentLayout(lines)
+	highlightIndex, offset := 0, 0
+	var buf strings.Builder
+	for index, tokens := range lines {
+		line := firstLine + index
+		lineOffset := offset
+		offset += tokensLength(tokens)
+		highlight, next := f.shouldHighlight(highlightIndex, line)
+		if next {
+			highlightIndex++
+		}
+		if !f.inWindow(line) {
+			continue
+		}
+		buf.Reset()
+		f.writeLine(&buf, classes, tokens, line, lineOffset, highlight, layout)
+		if err := fn(line, buf.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatLine renders a single line of tokens, identified by its line number,
+// in the same way as FormatLines. This allows lines to be rendered on demand,
+// eg. for virtual scrolling.
+func (f *Formatter) FormatLine(style *chroma.Style, tokens []chroma.Token, lineNumber int) (string, error) {
+	lines := chroma.SplitTokensIntoLines(tokens)
+	index := lineNumber - f.firstLine()
+	if index < 0 || index >= len(lines) {
+		return "", fmt.Errorf("line %d out of range", lineNumber)
+	}
+	f = f.withHighlightsEndingAt(f.firstLine() + len(lines) - 1)
+	var buf strings.Builder
+	highlight := lineInRanges(lineNumber, f.highlightRanges)
+	offset := 0
+	for _, tokens := range lines[:index] {
+		offset += tokensLength(tokens)
+	}
+	f.writeLine(&buf, f.classCache.get(style, f.darkStyle), lines[index], lineNumber, offset, highlight, f.fragmentLayout(lines))
+	return buf.String(), nil
+}
+
+// fragmentLayout returns the layout of lines rendered individually by
+// FormatLines and FormatLine.
+func (f *Formatter) fragmentLayout(lines [][]chroma.Token) lineLayout {
+	firstLine := f.firstLine()
+	digits := len(strconv.Itoa(firstLine + len(lines) - 1))
+	if f.dualLineNumbers != nil {
+		digits = f.dualLineDigits(len(lines), firstLine)
+	}
+	return lineLayout{
+		tag:       "span",
+		digits:    digits,
+		firstLine: firstLine,
+		diff:      f.hasDiffLines(lines),
+	}
+}
+
+// We deliberately don't use html/template here because it is two orders of magnitude slower (benchmarked).
+//
+// OTOH we need to be super careful about correct escaping...
+//
+// Output is written with io.WriteString rather than fmt where possible, which
+// avoids formatting overhead and writes directly to writers implementing
+// io.StringWriter, such as *bytes.Buffer and *strings.Builder.
+//
+// If beforeLine is not nil it is called before each rendered line with the
+// number of lines rendered so far.
+func (f *Formatter) writeHTML(w io.Writer, style *chroma.Style, tokens []chroma.Token, beforeLine func(rendered int) error) error {
+	if f.trimTrailingNewline || (!f.trimTrailingNewlineSet && f.inlineCode) {
+		tokens = trimTrailingNewline(tokens)
+	}
+	lines := chroma.SplitTokensIntoLines(tokens)
+	next := func() ([]chroma.Token, bool) {
+		if len(lines) == 0 {
+			return nil, false
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return line, true
+	}
+	return f.writeLines(w, style, next, len(lines), tokens, beforeLine)
+}
+
+// writeLines writes the lines returned by next until it returns false.
+// lineCount is the number of lines, or -1 if unknown when streaming, in which
+// case canStream must be true. source holds the tokens of the lines, except
+// when streaming.
+func (f *Formatter) writeLines(w io.Writer, style *chroma.Style, next func() ([]chroma.Token, bool), lineCount int, source []chroma.Token, beforeLine func(rendered int) error) (err error) { // nolint: gocyclo
+	firstLine := f.firstLine()
+	if lineCount >= 0 {
+		f = f.withHighlightsEndingAt(firstLine + lineCount - 1)
+	}
+	// The writes themselves are unchecked; the first error stops the output
+	// and is returned.
+	ew := &errWriter{w: w}
+	w = ew
+
+	classes := f.classCache.get(style, f.darkStyle)
+	if f.standalone {
+		f.writeDocumentStart(w, classes)
+		if f.standaloneTitle != "" {
+			fmt.Fprintf(w, "<div role=\"region\" aria-label=\"%s\">%s", html.EscapeString(f.standaloneTitle), f.newline())
+		}
+	}
+
+	f.writeHighlightTOC(w)
+
+	captioned := f.captioned()
+	if captioned {
+		fmt.Fprintf(w, "<figure><figcaption%s>%s</figcaption>", f.classAttr(classes, chroma.Background, f.captionClass), html.EscapeString(f.caption))
+	}
+
+	copyButton := f.copyButton && f.standalone
+	if copyButton {
+		fmt.Fprintf(w, "<div%s><button type=\"button\"%s data-clipboard-text=\"%s\">Copy</button>",
+			f.utilityAttr("relative"), f.utilityAttr(strings.Fields(copyButtonClasses)...), html.EscapeString(tokensText(source)))
+	}
+
+	wrapInTable := f.lineNumbers && f.lineNumbersInTable
+
+	collapsed := f.collapses(lineCount)
+	if collapsed {
+		f.writeCollapseStart(w, classes, lineCount)
+	}
+
+	// Without line numbers, the width is unused when streaming.
+	lineDigits := len(strconv.Itoa(firstLine))
+	if lineCount >= 0 {
+		lineDigits = len(strconv.Itoa(firstLine + lineCount - 1))
+	}
+	if f.dualLineNumbers != nil && lineCount >= 0 {
+		lineDigits = f.dualLineDigits(lineCount, firstLine)
+	}
+
+	// DiffMarkers are never streamed, so the lines are known.
+	var diffLines [][]chroma.Token
+	if f.diffMarkers {
+		diffLines = chroma.SplitTokensIntoLines(source)
+	}
+	diff := f.hasDiffLines(diffLines)
+
+	// List line numbers in its own <td>
+	writeLineNumbersColumn := func() {
+		if f.dualLineNumbers != nil {
+			f.writeDualLineNumbers(w, classes, lineCount, firstLine, lineDigits)
+		} else {
+			f.writeGutterColumn(w, classes, lineCount, firstLine, func(line int) string {
+				return f.gutterCell(classes, f.lineIDAttribute(line)+f.lineDataAttr(line), f.lineTitleWithLinkIfNeeded(classes, lineDigits, line))
+			})
+		}
+	}
+	if wrapInTable {
+		fmt.Fprintf(w, "<div%s%s>%s", f.classAttr(classes, chroma.PreWrapper, f.outerDivClass), f.containerAttrs(lineCount), f.newline())
+		fmt.Fprintf(w, "<table%s><tr%s>", f.classAttr(classes, chroma.LineTable), f.utilityAttr(strings.Fields(f.rowClass)...))
+		if f.metaColumn != nil {
+			f.writeGutterColumn(w, classes, lineCount, firstLine, func(line int) string {
+				return f.gutterCell(classes, "", html.EscapeString(f.metaColumn(line)))
+			})
+		}
+		if !f.lineNumbersRight {
+			writeLineNumbersColumn()
+		}
+		if diff {
+			f.writeGutterColumn(w, classes, lineCount, firstLine, func(line int) string {
+				return f.gutterCell(classes, "", f.diffMarker(classes, diffLineType(diffLines[line-firstLine])))
+			})
+		}
+		fmt.Fprintf(w, "<td%s>%s", f.classAttr(classes, chroma.LineTableTD, f.codeColumnClasses()), f.newline())
+	}
+
+	preAttrs := f.classAttr(classes, chroma.PreWrapper, f.codePadding)
+	if !wrapInTable {
+		preAttrs += f.containerAttrs(lineCount)
+	}
+	io.WriteString(w, f.preStart(true, preAttrs, lineCount))
+	layout := lineLayout{tag: "span", digits: lineDigits, firstLine: firstLine, inTable: wrapInTable, diff: diff && !wrapInTable}
+	if f.listItems() {
+		layout.tag = "li"
+		role := ""
+		if !f.linesAsListItems {
+			// Some screen readers drop the semantics of unstyled lists.
+			role = ` role="list"`
+		}
+		fmt.Fprintf(w, "<ol%s%s>", f.utilityAttr("list-none", "m-0", "p-0"), role)
+	}
+
+	gridRows := f.gridRowHighlights()
+	if gridRows {
+		// The lines and overlays must be items of the same grid, which the
+		// <code> of the wrapper would otherwise be the only item of.
+		fmt.Fprintf(w, "<span%s>", f.utilityAttr(gridRowsContainerClasses...))
+	}
+	// Grid row of each rendered line, for gridRows.
+	rows, row := map[int]int{}, 0
+	highlightIndex := 0
+	prevLine, rendered, renderedCount := 0, false, 0
+	offset := 0
+	for index := 0; ; index++ {
+		tokens, ok := next()
+		if !ok {
+			break
+		}
+		// 1-based line number.
+		line := firstLine + index
+		lineOffset := offset
+		offset += tokensLength(tokens)
+		if !f.inWindow(line) {
+			continue
+		}
+		if beforeLine != nil {
+			if err := beforeLine(renderedCount); err != nil {
+				return err
+			}
+		}
+		renderedCount++
+		if rendered && line != prevLine+1 {
+			fmt.Fprintf(w, "<span%s>%s\n</span>", f.classAttr(classes, chroma.Line, "select-none", f.gapMarkerClass), html.EscapeString(f.gapMarker))
+			row++ // The gap occupies a row.
+		}
+		prevLine, rendered = line, true
+		row++
+		rows[line] = row
+		highlight, next := f.shouldHighlight(highlightIndex, line)
+		if next {
+			highlightIndex++
+		}
+		if gridRows {
+			// Highlights are drawn by the overlays instead.
+			highlight = false
+		}
+
+		f.writeLine(w, classes, tokens, line, lineOffset, highlight, layout)
+		if ew.err != nil {
+			return ew.err
+		}
+	}
+	if gridRows {
+		f.writeHighlightOverlays(w, classes, rows)
+		io.WriteString(w, "</span>")
+	}
+	if layout.tag == "li" {
+		io.WriteString(w, "</ol>")
+	}
+	io.WriteString(w, f.preEnd(true))
+
+	if wrapInTable {
+		io.WriteString(w, "</td>")
+		if f.lineNumbersRight {
+			writeLineNumbersColumn()
+		}
+		if f.sideAnnotations != nil {
+			f.writeGutterColumn(w, classes, lineCount, firstLine, func(line int) string {
+				note, ok := f.sideAnnotations[line]
+				if !ok {
+					return f.gutterCell(classes, "", "")
+				}
+				return f.gutterCell(classes, "", fmt.Sprintf("<span%s>%s</span>", f.utilityAttr(strings.Fields(f.sideAnnotationClass)...), html.EscapeString(note)))
+			})
+		}
+		io.WriteString(w, "</tr></table>"+f.newline())
+		io.WriteString(w, "</div>"+f.newline())
+	}
+	if collapsed {
+		f.writeCollapseEnd(w)
+	}
+
+	if copyButton {
+		io.WriteString(w, "</div>")
+	}
+
+	if f.plainFallback && !f.inlineCode {
+		f.writePlainFallback(w, source)
+	}
+	if captioned {
+		io.WriteString(w, "</figure>")
+	}
+
+	if f.standalone {
+		if f.standaloneTitle != "" {
+			io.WriteString(w, f.newline()+"</div>")
+		}
+		if copyButton {
+			fmt.Fprintf(w, "%s<script%s>%s</script>", f.newline(), f.nonceAttr(), copyButtonScript)
+		}
+		f.writeDocumentEnd(w)
+	}
+
+	return ew.err
+}
+
+// copyButtonClasses position the WithCopyButton button over the code.
+const copyButtonClasses = "absolute top-2 right-2 px-2 py-1 text-xs rounded border border-current opacity-75"
+
+// copyButtonScript copies the source held by a WithCopyButton button when it
+// is clicked.
+const copyButtonScript = `document.addEventListener("click",function(e){` +
+	`var b=e.target.closest&&e.target.closest("button[data-clipboard-text]");` +
+	`if(b)navigator.clipboard.writeText(b.getAttribute("data-clipboard-text"))})`
+
+// nonceAttr returns the WithNonce attribute for inline elements.
+func (f *Formatter) nonceAttr() string {
+	if f.nonce == "" {
+		return ""
+	}
+	return fmt.Sprintf(` nonce="%s"`, html.EscapeString(f.nonce))
+}
+
+// tokensText returns the source of tokens.
+func tokensText(tokens []chroma.Token) string {
+	var text strings.Builder
+	text.Grow(tokensLength(tokens))
+	for _, token := range tokens {
+		text.WriteString(token.Value)
+	}
+	return text.String()
+}
+
+// writePlainFallback writes the source of tokens for WithPlainFallback.
+func (f *Formatter) writePlainFallback(w io.Writer, tokens []chroma.Token) {
+	fmt.Fprintf(w, "<pre%s>", f.utilityAttr("sr-only"))
+	for _, token := range tokens {
+		if f.assumeEscaped {
+			io.WriteString(w, token.Value)
+		} else {
+			io.WriteString(w, html.EscapeString(token.Value))
+		}
+	}
+	io.WriteString(w, "</pre>")
+}
+
+// writeHighlightTOC writes the list of links to highlighted ranges for
+// WithHighlightTOC.
+func (f *Formatter) writeHighlightTOC(w io.Writer) {
+	if !f.highlightTOC || !f.lineNumbers || !f.linkableLineNumbers || len(f.highlightRanges) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "<nav aria-label=\"Highlighted lines\"><ul%s>%s", f.utilityAttr(strings.Fields(f.highlightTOCClass)...), f.newline())
+	for _, hrange := range f.highlightRanges {
+		label := f.highlightTOCLabel
+		if label == nil {
+			label = defaultHighlightTOCLabel
+		}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>%s", html.EscapeString(f.lineHref(hrange[0])), html.EscapeString(label(hrange[0], hrange[1])), f.newline())
+	}
+	io.WriteString(w, "</ul></nav>"+f.newline())
+}
+
+func defaultHighlightTOCLabel(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("Line %d", start)
+	}
+	return fmt.Sprintf("Lines %d–%d", start, end)
+}
+
+// writeDocumentStart writes the start of a standalone document, up to the
+// opening <body>.
+func (f *Formatter) writeDocumentStart(w io.Writer, classes map[chroma.TokenType]string) {
+	nl := f.newline()
+	fmt.Fprintf(w, "<!DOCTYPE html>%s<html lang=\"%s\">%s<head>%s<meta charset=\"utf-8\">%s", nl, html.EscapeString(f.standaloneLang), nl, nl, nl)
+	if f.standaloneTitle != "" {
+		fmt.Fprintf(w, "<title>%s</title>%s", html.EscapeString(f.standaloneTitle), nl)
+	}
+	if f.standaloneHead != "" {
+		io.WriteString(w, f.standaloneHead+nl)
+	}
+	io.WriteString(w, "</head>"+nl)
+	fmt.Fprintf(w, "<body%s>%s", f.classAttr(classes, chroma.Background, f.standaloneBodyClass), nl)
+}
+
+// newline returns the newline separating structural elements outside of the
+// code, or nothing with Minify.
+func (f *Formatter) newline() string {
+	if f.minify {
+		return ""
+	}
+	return "\n"
+}
+
+// writeDocumentEnd writes the end of a standalone document.
+func (f *Formatter) writeDocumentEnd(w io.Writer) {
+	nl := f.newline()
+	io.WriteString(w, nl+"</body>"+nl)
+	io.WriteString(w, "</html>"+nl)
+}
+
+// lineLayout describes how lines are laid out within the code block.
+type lineLayout struct {
+	tag       string // Element wrapping each line.
+	digits    int    // Width of the widest line number.
+	firstLine int
+	inTable   bool // Line numbers are in a separate table column.
+	diff      bool // Lines start with a DiffMarkers glyph.
+}
+
+// writeLine writes a single line of tokens.
+//
+// offset is the byte offset of the line in the source, for TokenPositionData.
+func (f *Formatter) writeLine(w io.Writer, classes map[chroma.TokenType]string, tokens []chroma.Token, line, offset int, highlight bool, layout lineLayout) {
+	wrapped := f.wrapsLines()
+	if wrapped {
+		// Start of Line
+		lineClasses := []string{classes[chroma.Line]}
+		if highlight {
+			// Line + LineHighlight
+			lineClasses = append(lineClasses, classes[chroma.LineHighlight])
+			if !layout.inTable {
+				lineClasses = append(lineClasses, f.prefixedClasses(strings.Fields(f.highlightAccentClasses()))...)
+			}
+		}
+		if group := f.highlightGroupFor(line); group != nil {
+			lineClasses = append(lineClasses, f.prefixedClasses(strings.Fields(group.class))...)
+		}
+		if f.dimmed(line, highlight) {
+			lineClasses = append(lineClasses, f.prefixedClasses(strings.Fields(f.dimUnhighlighted))...)
+		}
+		for _, where := range f.highlightWheres {
+			if lineInRanges(line, where.ranges) && where.pred(tokens) {
+				lineClasses = append(lineClasses, f.prefixedClasses(strings.Fields(where.class))...)
+			}
+		}
+		if f.wrapLines != nil && lineInRanges(line, f.wrapLines) {
+			lineClasses = append(lineClasses, f.prefixedClasses([]string{"whitespace-pre-wrap", "break-words"})...)
+		}
+		if f.scrollSnap && f.isSnapPoint(line, layout.firstLine) {
+			lineClasses = append(lineClasses, prefixClass(f.prefix, "snap-start"))
+		}
+		anchor := f.highlightAnchorAttr(line)
+		if anchor != "" {
+			lineClasses = append(lineClasses, f.prefixedClasses(strings.Fields(f.highlightAnchorClass))...)
+		}
+		value := ""
+		if layout.tag == "li" && f.lineNumbersAsList {
+			value = fmt.Sprintf(` value="%d"`, line)
+		}
+		start := "<" + layout.tag + f.joinedClassAttr(lineClasses...) + value + anchor + f.highlightDataAttrs(highlight, line) + f.lineDataAttr(line) + ">"
+		label := f.highlightLabel(highlight, line)
+		if f.minimalPlainOutput && f.flatLines && start == "<span>" && label == "" && !(f.lineNumbers && !layout.inTable) && !layout.diff {
+			// An inline line element without attributes or content of its own
+			// changes nothing.
+			wrapped = false
+		} else {
+			io.WriteString(w, start)
+		}
+
+		if label != "" {
+			fmt.Fprintf(w, "<span%s>%s: </span>", f.utilityAttr("sr-only", "select-none"), html.EscapeString(label))
+		}
+
+		// Line number
+		if f.lineNumbers && !layout.inTable && !f.lineNumbersRight {
+			f.writeLineNumber(w, classes, line, layout)
+		}
+		if layout.diff {
+			io.WriteString(w, f.diffMarker(classes, diffLineType(tokens)))
+		}
+
+		switch {
+		case f.flatLines:
+		case isBlankLine(tokens):
+			// Keep blank lines one line high where the newline alone doesn't.
+			io.WriteString(w, "<span"+f.classAttr(classes, chroma.CodeLine, "min-h-[1lh]")+">")
+		default:
+			io.WriteString(w, "<span"+f.classAttr(classes, chroma.CodeLine)+">")
+		}
+	} else if f.lineNumbers && !layout.inTable {
+		// Without the line elements, the number precedes the tokens.
+		f.writeLineNumber(w, classes, line, layout)
+	}
+
+	// Mixed indentation is detected before tabs are expanded.
+	unexpanded := tokens
+	if f.expandTabs {
+		tokens = f.expandLineTabs(tokens)
+	}
+	if f.mergeWhitespace {
+		tokens = mergeWhitespace(tokens)
+	}
+	lineTokens := tokens
+	if f.flagMixedIndent != "" {
+		indent, rest := splitIndent(tokens)
+		if original, _ := splitIndent(unexpanded); isMixedIndent(original) {
+			fmt.Fprintf(w, "<span%s>", f.utilityAttr(strings.Fields(f.flagMixedIndent)...))
+			for _, token := range indent {
+				io.WriteString(w, f.tokenHTML(classes, token, line, offset))
+				offset += len(token.Value)
+			}
+			io.WriteString(w, "</span>")
+			tokens = rest
+		}
+	} else if f.indentGuides {
+		indent, rest := splitIndent(tokens)
+		// Blank lines have no guides.
+		if len(indent) > 0 && len(rest) > 0 && rest[0].Value[0] != '\n' {
+			offset = f.writeIndentGuides(w, classes, indent, line, offset)
+			tokens = rest
+		}
+	} else if f.indentClass != "" {
+		indent, rest := splitIndent(tokens)
+		if len(indent) > 0 && len(rest) > 0 && rest[0].Value[0] != '\n' {
+			fmt.Fprintf(w, "<span%s>", f.utilityAttr(strings.Fields(f.indentClass)...))
+			f.writeTokens(w, classes, indent, line, offset)
+			offset += tokensLength(indent)
+			io.WriteString(w, "</span>")
+			tokens = rest
+		}
+	}
+	if spans := f.highlightSpans[line]; spans != nil && !highlight {
+		// Whole highlighted lines need no spans within them.
+		walker := f.newColumnWalker()
+		for _, token := range lineTokens[:len(lineTokens)-len(tokens)] {
+			walker.walk(token.Value)
+		}
+		f.writeSpanHighlights(w, classes, tokens, line, offset, walker, spans)
+	} else {
+		f.writeTokens(w, classes, tokens, line, offset)
+	}
+
+	if wrapped {
+		if !f.flatLines {
+			io.WriteString(w, `</span>`) // End of CodeLine
+		}
+		if f.lineNumbers && !layout.inTable && f.lineNumbersRight {
+			f.writeLineNumber(w, classes, line, layout)
+		}
+
+		io.WriteString(w, "</"+layout.tag+">") // End of Line
+	}
+}
+
+// isBlankLine reports whether a line has no content other than its newline.
+func isBlankLine(tokens []chroma.Token) bool {
+	for _, token := range tokens {
+		if token.Value != "" && token.Value != "\n" {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapsLines reports whether each line is wrapped in Line and CodeLine
+// elements. Without a surrounding <pre>, or with MinimalPlainOutput when no
+// options apply to individual lines, the tokens are written directly.
+func (f *Formatter) wrapsLines() bool {
+	if f.preventSurroundingPre || f.inlineCode {
+		return false
+	}
+	return !f.minimalPlainOutput || f.lineNumbers || f.hasHighlights() || f.wrapLines != nil ||
+		f.lineWindows != nil || f.listItems() || f.scrollSnap || f.flagMixedIndent != "" || f.indentGuides ||
+		f.diffMarkers || f.lineDataAttribute
+}
+
+// writeLineNumber writes the line number span of a line outside a table.
+func (f *Formatter) writeLineNumber(w io.Writer, classes map[chroma.TokenType]string, line int, layout lineLayout) {
+	if f.dualLineNumbers != nil {
+		for _, number := range f.dualLineNumber(line) {
+			fmt.Fprintf(w, "<span%s>%s</span>", f.classAttr(classes, chroma.LineNumbers), dualLineNumberText(number, layout.digits))
+		}
+		return
+	}
+	fmt.Fprintf(w, "<span%s%s>%s</span>", f.classAttr(classes, chroma.LineNumbers), f.lineIDAttribute(line), f.lineTitleWithLinkIfNeeded(classes, layout.digits, line))
+}
+
+// indentGuideClasses draw an indent guide. The negative margin offsets the
+// width of the border, so guides don't shift the code.
+const indentGuideClasses = "border-l border-gray-500/30 -ml-px"
+
+// writeIndentGuides writes the leading indentation of a line with a guide
+// for each complete level, returning the offset following the indentation.
+func (f *Formatter) writeIndentGuides(w io.Writer, classes map[chroma.TokenType]string, indent []chroma.Token, line, offset int) int {
+	var text strings.Builder
+	for _, token := range indent {
+		text.WriteString(token.Value)
+	}
+	// Levels are split on columns rather than characters, so tabs and spaces
+	// can be mixed. A tab never crosses a level, as levels are one tab wide.
+	indentText := text.String()
+	tokenType := indent[0].Type
+	columns, start := f.newColumnWalker(), 0
+	for i, r := range indentText {
+		columns.next(r)
+		if !columns.atTabStop() {
+			continue
+		}
+		level := chroma.Token{Type: tokenType, Value: indentText[start : i+1]}
+		io.WriteString(w, "<span"+f.utilityAttr(strings.Fields(indentGuideClasses)...)+">"+f.tokenHTML(classes, level, line, offset)+"</span>")
+		offset += len(level.Value)
+		start = i + 1
+	}
+	if start < len(indentText) {
+		io.WriteString(w, f.tokenHTML(classes, chroma.Token{Type: tokenType, Value: indentText[start:]}, line, offset))
+		offset += len(indentText) - start
+	}
+	return offset
+}
+
+// tokensLength returns the length in bytes of the text of tokens.
+func tokensLength(tokens []chroma.Token) int {
+	n := 0
+	for _, token := range tokens {
+		n += len(token.Value)
+	}
+	return n
+}
+
+// splitIndent splits the tokens of a line into its leading indentation and the
+// remainder, splitting a token if the indentation ends within it.
+func splitIndent(tokens []chroma.Token) (indent, rest []chroma.Token) {
+	for i, token := range tokens {
+		n := len(token.Value) - len(strings.TrimLeft(token.Value, " \t"))
+		if n == len(token.Value) {
+			indent = append(indent, token)
+			continue
+		}
+		if n > 0 {
+			indent = append(indent, chroma.Token{Type: token.Type, Value: token.Value[:n]})
+			token.Value = token.Value[n:]
+		}
+		rest = append([]chroma.Token{token}, tokens[i+1:]...)
+		return indent, rest
+	}
+	return indent, nil
+}
+
+// mergeWhitespace returns tokens with each run of consecutive text tokens made
+// up only of whitespace merged into one, of the type of the first. Tokens are
+// copied rather than modified, as they may be shared.
+func mergeWhitespace(tokens []chroma.Token) []chroma.Token {
+	isWhitespace := func(token chroma.Token) bool {
+		return token.Type.InCategory(chroma.Text) && token.Value != "" && strings.TrimSpace(token.Value) == ""
+	}
+	out := make([]chroma.Token, 0, len(tokens))
+	for _, token := range tokens {
+		if n := len(out); n > 0 && isWhitespace(token) && isWhitespace(out[n-1]) {
+			out[n-1].Value += token.Value
+			continue
+		}
+		out = append(out, token)
+	}
+	return out
+}
+
+// isMixedIndent reports whether indent contains both tabs and spaces.
+func isMixedIndent(indent []chroma.Token) bool {
+	tabs, spaces := false, false
+	for _, token := range indent {
+		tabs = tabs || strings.Contains(token.Value, "\t")
+		spaces = spaces || strings.Contains(token.Value, " ")
+	}
+	return tabs && spaces
+}
+
+// trimTrailingNewline returns tokens without a single trailing newline. Tokens
+// are copied rather than modified, as they may be shared.
+func trimTrailingNewline(tokens []chroma.Token) []chroma.Token {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Value == "" {
+			continue
+		}
+		if !strings.HasSuffix(tokens[i].Value, "\n") {
+			return tokens
+		}
+		out := append([]chroma.Token(nil), tokens[:i+1]...)
+		out[i].Value = strings.TrimSuffix(out[i].Value, "\n")
+		if out[i].Value == "" {
+			out = out[:i]
+		}
+		return out
+	}
+	return tokens
+}
+
+// firstLine returns the number of the first line in the block.
+func (f *Formatter) firstLine() int {
+	if f.zeroBasedLines && !f.baseLineNumberSet {
+		return 0
+	}
+	return f.baseLineNumber
+}
+
+// containerAttrs returns the attributes, other than the class, of the outermost
+// code element.
+func (f *Formatter) containerAttrs(lineCount int) string {
+	attrs := f.ariaAttrs(lineCount)
+	if f.themeNames[0] != "" {
+		attrs += fmt.Sprintf(` data-theme-light="%s"`, html.EscapeString(f.themeNames[0]))
+	}
+	if f.themeNames[1] != "" {
+		attrs += fmt.Sprintf(` data-theme-dark="%s"`, html.EscapeString(f.themeNames[1]))
+	}
+	return attrs
+}
+
+// ariaAttrs returns the accessibility attributes for the outermost code
+// element, if enabled.
+func (f *Formatter) ariaAttrs(lineCount int) string {
+	if !f.accessible {
+		return ""
+	}
+	label := "Code block"
+	if f.language != "" {
+		label = f.language + " code block"
+	}
+	if lineCount == 1 {
+		label += ", 1 line"
+	} else {
+		label += fmt.Sprintf(", %d lines", lineCount)
+	}
+	return fmt.Sprintf(` role="region" aria-label="%s"`, html.EscapeString(label))
+}
+
+// codeColumnClasses returns the extra classes of the code cell in table mode.
+func (f *Formatter) codeColumnClasses() string {
+	if f.shrinkCodeColumn {
+		return ""
+	}
+	return f.codeColumnClass
+}
+
+// writeGutterColumn writes a table cell listing something for each line, such
+// as its line number, with cell rendering the entry for a line. Entries are
+// kept aligned with the code column, including highlights and window gaps.
+func (f *Formatter) writeGutterColumn(w io.Writer, classes map[chroma.TokenType]string, lineCount, firstLine int, cell func(line int) string) {
+	fmt.Fprintf(w, "<td%s>%s", f.classAttr(classes, chroma.LineTableTD), f.newline())
+	io.WriteString(w, f.preStart(false, f.classAttr(classes, chroma.PreWrapper), lineCount))
+	highlightIndex := 0
+	prevLine, rendered := 0, false
+	for index := 0; index < lineCount; index++ {
+		line := firstLine + index
+		if !f.inWindow(line) {
+			continue
+		}
+		if rendered && line != prevLine+1 {
+			io.WriteString(w, f.gutterCell(classes, "", ""))
+		}
+		prevLine, rendered = line, true
+		highlight, next := f.shouldHighlight(highlightIndex, line)
+		if next {
+			highlightIndex++
+		}
+		group := f.highlightGroupFor(line)
+		groupClass := ""
+		if group != nil {
+			groupClass = group.class
+		}
+		dimmed := f.dimmed(line, highlight)
+		display := ""
+		if f.blockLineNumbers {
+			display = "block"
+		}
+		switch {
+		case highlight:
+			fmt.Fprintf(w, "<span%s%s>", f.classAttr(classes, chroma.LineHighlight, f.highlightAccentClasses(), groupClass, display), f.highlightDataAttrs(highlight, line))
+		case group != nil:
+			fmt.Fprintf(w, "<span%s>", f.utilityAttr(append(strings.Fields(groupClass), display)...))
+		case dimmed:
+			fmt.Fprintf(w, "<span%s>", f.utilityAttr(append(strings.Fields(f.dimUnhighlighted), display)...))
+		}
+
+		io.WriteString(w, cell(line))
+
+		if highlight || group != nil || dimmed {
+			fmt.Fprintf(w, "</span>")
+		}
+	}
+	io.WriteString(w, f.preEnd(false))
+	io.WriteString(w, "</td>"+f.newline())
+}
+
+// writeDualLineNumbers writes the old and new line number columns of
+// DualLineNumbers.
+func (f *Formatter) writeDualLineNumbers(w io.Writer, classes map[chroma.TokenType]string, lineCount, firstLine, digits int) {
+	for side := range 2 {
+		f.writeGutterColumn(w, classes, lineCount, firstLine, func(line int) string {
+			return f.gutterCell(classes, f.lineDataAttr(line), dualLineNumberText(f.dualLineNumber(line)[side], digits))
+		})
+	}
+}
+
+// dualLineNumber returns the old and new line numbers of line for
+// DualLineNumbers, or 0 for a side the line is absent from.
+func (f *Formatter) dualLineNumber(line int) [2]int {
+	oldLine, newLine := f.dualLineNumbers(line)
+	number := [2]int{}
+	if oldLine > 0 {
+		number[0] = f.dualLineBases[0] + oldLine - 1
+	}
+	if newLine > 0 {
+		number[1] = f.dualLineBases[1] + newLine - 1
+	}
+	return number
+}
+
+// dualLineDigits returns the width of the widest DualLineNumbers number of
+// lineCount lines from firstLine.
+func (f *Formatter) dualLineDigits(lineCount, firstLine int) int {
+	digits := 1
+	for index := 0; index < lineCount; index++ {
+		number := f.dualLineNumber(firstLine + index)
+		digits = max(digits, len(strconv.Itoa(number[0])), len(strconv.Itoa(number[1])))
+	}
+	return digits
+}
+
+// dualLineNumberText returns number padded to digits, or blank if it is 0.
+func dualLineNumberText(number, digits int) string {
+	if number == 0 {
+		return strings.Repeat(" ", digits)
+	}
+	return fmt.Sprintf("%*d", digits, number)
+}
+
+// gutterCell returns the entry for a line in a table gutter column. Entries are
+// separated by newlines, or are block elements with BlockLineNumbers.
+func (f *Formatter) gutterCell(classes map[chroma.TokenType]string, attrs, content string) string {
+	if !f.blockLineNumbers {
+		return fmt.Sprintf("<span%s%s>%s\n</span>", f.classAttr(classes, chroma.LineNumbersTable), attrs, content)
+	}
+	if content == "" {
+		// Keep empty entries one line high.
+		content = " "
+	}
+	return fmt.Sprintf("<span%s%s>%s</span>", f.classAttr(classes, chroma.LineNumbersTable, "block"), attrs, content)
+}
+
+func (f *Formatter) lineIDAttribute(line int) string {
+	if !f.linkableLineNumbers {
+		return ""
+	}
+	return fmt.Sprintf(" id=\"%s\"", html.EscapeString(f.lineID(line)))
+}
+
+func (f *Formatter) lineTitleWithLinkIfNeeded(classes map[chroma.TokenType]string, lineDigits, line int) string {
+	if f.lineNumberStep > 1 && line != f.firstLine() && line%f.lineNumberStep != 0 {
+		// Keep the gutter its full width.
+		return strings.Repeat(" ", lineDigits)
+	}
+	title := fmt.Sprintf("%*d", lineDigits, line)
+	if !f.linkableLineNumbers {
+		return title
+	}
+	attrs := ""
+	if f.lineLinkRel != "" {
+		attrs += fmt.Sprintf(` rel="%s"`, html.EscapeString(f.lineLinkRel))
+	}
+	if f.lineLinkTarget != "" {
+		attrs += fmt.Sprintf(` target="%s"`, html.EscapeString(f.lineLinkTarget))
+	}
+	return fmt.Sprintf("<a%s href=\"%s\"%s>%s</a>", f.classAttr(classes, chroma.LineLink), html.EscapeString(f.lineHref(line)), attrs, title)
+}
+
+func (f *Formatter) lineID(line int) string {
+	if f.lineAnchors != nil {
+		id, _ := f.lineAnchors(line)
+		return id
+	}
+	return fmt.Sprintf("%s%d", f.lineNumbersIDPrefix, line)
+}
+
+// lineHref returns the href of the link to line.
+func (f *Formatter) lineHref(line int) string {
+	if f.lineAnchors != nil {
+		_, href := f.lineAnchors(line)
+		return href
+	}
+	return "#" + f.lineID(line)
+}
+
+// gridRowsContainerClasses lay out the lines of HighlightViaGridRows as grid
+// rows, containing the overlays placed behind them.
+var gridRowsContainerClasses = []string{"grid", "relative", "isolate"}
+
+// gridRowHighlights reports whether highlights are drawn as overlays spanning
+// rows of the grid layout, with HighlightViaGridRows.
+func (f *Formatter) gridRowHighlights() bool {
+	return f.highlightViaGridRows && len(f.highlightRanges) > 0 && f.highlightLayout != HighlightLayoutBlock &&
+		!f.listItems() && !(f.preventSurroundingPre || f.inlineCode)
+}
+
+// writeHighlightOverlays writes an element for each highlight range, placed
+// behind the lines it covers using the grid rows given for each line.
+func (f *Formatter) writeHighlightOverlays(w io.Writer, classes map[chroma.TokenType]string, rows map[int]int) {
+	for _, hrange := range f.highlightRanges {
+		start, end := 0, 0
+		for line := hrange[0]; line <= hrange[1]; line++ {
+			row, ok := rows[line]
+			if !ok {
+				continue
+			}
+			if start == 0 {
+				start = row
+			}
+			end = row
+		}
+		if start == 0 {
+			continue
+		}
+		placement := arbitraryValue("row-start", strconv.Itoa(start)) + " " + arbitraryValue("row-end", strconv.Itoa(end+1))
+		fmt.Fprintf(w, `<span%s aria-hidden="true"></span>`, f.classAttr(classes, chroma.LineHighlight, "absolute inset-0 -z-10 pointer-events-none", placement))
+	}
+}
+
+// hasHighlights reports whether any lines may be highlighted.
+func (f *Formatter) hasHighlights() bool {
+	return len(f.highlightRanges) > 0 || len(f.highlightGroups) > 0 || len(f.highlightWheres) > 0
+}
+
+// dimmed reports whether line is dimmed by DimUnhighlighted.
+func (f *Formatter) dimmed(line int, highlight bool) bool {
+	if f.dimUnhighlighted == "" || highlight || (len(f.highlightRanges) == 0 && len(f.highlightGroups) == 0) {
+		return false
+	}
+	return f.highlightGroupFor(line) == nil
+}
+
+// highlightGroupFor returns the highlight group line belongs to, or nil. When
+// groups overlap, the group added last wins.
+func (f *Formatter) highlightGroupFor(line int) *highlightGroup {
+	for i := len(f.highlightGroups) - 1; i >= 0; i-- {
+		if lineInRanges(line, f.highlightGroups[i].ranges) {
+			return &f.highlightGroups[i]
+		}
+	}
+	return nil
+}
+
+// highlightDataAttrs returns the data attributes marking a highlighted line,
+// if enabled.
+func (f *Formatter) highlightDataAttrs(highlight bool, line int) string {
+	if !f.highlightDataAttribute || !highlight {
+		return ""
+	}
+	return fmt.Sprintf(` data-highlighted="true" data-highlight-range="%d"`, f.highlightRangeIndex(line))
+}
+
+// lineDataAttr returns the data-line attribute of LineDataAttribute, if
+// enabled.
+func (f *Formatter) lineDataAttr(line int) string {
+	if !f.lineDataAttribute {
+		return ""
+	}
+	return fmt.Sprintf(` data-line="%d"`, line)
+}
+
+// highlightLabel returns the screen reader label for line, or "" if it has
+// none.
+func (f *Formatter) highlightLabel(highlight bool, line int) string {
+	if !f.accessible {
+		return ""
+	}
+	if group := f.highlightGroupFor(line); group != nil {
+		if label, ok := f.highlightLabels[group.name]; ok {
+			return label
+		}
+		return group.name
+	}
+	if !highlight {
+		return ""
+	}
+	if label, ok := f.highlightLabels[""]; ok {
+		return label
+	}
+	return "highlighted"
+}
+
+// highlightAnchorAttr returns the HighlightAnchors id attribute of line, if it
+// starts a highlight range.
+func (f *Formatter) highlightAnchorAttr(line int) string {
+	if f.highlightAnchors == "" {
+		return ""
+	}
+	for i, hrange := range f.highlightRanges {
+		if hrange[0] == line {
+			return fmt.Sprintf(` id="%s%d"`, html.EscapeString(f.highlightAnchors), i+1)
+		}
+	}
+	return ""
+}
+
+// highlightRangeIndex returns the index of the first highlight range, in
+// ascending order, containing line, or -1.
+func (f *Formatter) highlightRangeIndex(line int) int {
+	for i, hrange := range f.highlightRanges {
+		if line >= hrange[0] && line <= hrange[1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// highlightAccentClasses returns the unprefixed left accent bar utilities for
+// highlighted lines, if enabled. In table mode the bar is drawn on the gutter.
+func (f *Formatter) highlightAccentClasses() string {
+	if f.highlightAccent == "" {
+		return ""
+	}
+	return "border-l-4 " + f.highlightAccent
+}
+
+// isSnapPoint reports whether line starts a scroll-snap section: the first line
+// of the block and the first line of each highlighted range.
+func (f *Formatter) isSnapPoint(line, firstLine int) bool {
+	if line == firstLine {
+		return true
+	}
+	for _, hrange := range f.highlightRanges {
+		if hrange[0] == line {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultGapMarker separates discontiguous line windows.
+const defaultGapMarker = "⋯"
+
+func (f *Formatter) inWindow(line int) bool {
+	return f.lineWindows == nil || lineInRanges(line, f.lineWindows)
+}
+
+// lineInRanges reports whether line falls within any of the inclusive ranges.
+func lineInRanges(line int, ranges [][2]int) bool {
+	for _, r := range ranges {
+		if line >= r[0] && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Formatter) shouldHighlight(highlightIndex, line int) (bool, bool) {
+	next := false
+	for highlightIndex < len(f.highlightRanges) && line > f.highlightRanges[highlightIndex][1] {
+		highlightIndex++
+		next = true
+	}
+	if highlightIndex < len(f.highlightRanges) {
+		hrange := f.highlightRanges[highlightIndex]
+		if line >= hrange[0] && line <= hrange[1] {
+			return true, next
+		}
 	}
+	return false, next
+}
 
-	wrapInTable := f.lineNumbers && f.lineNumbersInTable
-
-	lines := chroma.SplitTokensIntoLines(tokens)
-	lineDigits := len(strconv.Itoa(f.baseLineNumber + len(lines) - 1))
-	highlightIndex := 0
-
-	if wrapInTable {
-		// List line numbers in its own <td>
-		fmt.Fprintf(w, "<div%s>\n", f.classAttr(classes, chroma.PreWrapper))
-		fmt.Fprintf(w, "<table%s><tr>", f.classAttr(classes, chroma.LineTable))
-		fmt.Fprintf(w, "<td%s>\n", f.classAttr(classes, chroma.LineTableTD))
-		fmt.Fprintf(w, "%s", f.preWrapper.Start(false, f.classAttr(classes, chroma.PreWrapper)))
-		for index := range lines {
-			line := f.baseLineNumber + index
-			highlight, next := f.shouldHighlight(highlightIndex, line)
-			if next {
-				highlightIndex++
-			}
-			if highlight {
-				fmt.Fprintf(w, "<span%s>", f.classAttr(classes, chroma.LineHighlight))
-			}
+// tokenHTML renders a single escaped token on line, starting at the byte
+// offset in the source, wrapped in a span if it needs one.
+func (f *Formatter) tokenHTML(classes map[chroma.TokenType]string, token chroma.Token, line, offset int) string {
+	return wrapToken(f.tokenParts(classes, token, line, offset))
+}
 
-			fmt.Fprintf(w, "<span%s%s>%s\n</span>", f.classAttr(classes, chroma.LineNumbersTable), f.lineIDAttribute(line), f.lineTitleWithLinkIfNeeded(classes, lineDigits, line))
+// writeTokens writes tokens, merging them with MergeAdjacentTokens.
+func (f *Formatter) writeTokens(w io.Writer, classes map[chroma.TokenType]string, tokens []chroma.Token, line, offset int) {
+	if f.mergeAdjacentTokens {
+		f.writeMergedTokens(w, classes, tokens, line, offset)
+		return
+	}
+	for _, token := range tokens {
+		io.WriteString(w, f.tokenHTML(classes, token, line, offset))
+		offset += len(token.Value)
+	}
+}
 
-			if highlight {
-				fmt.Fprintf(w, "</span>")
-			}
+// writeMergedTokens writes tokens for MergeAdjacentTokens.
+func (f *Formatter) writeMergedTokens(w io.Writer, classes map[chroma.TokenType]string, tokens []chroma.Token, line, offset int) {
+	var element, attrs string
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			io.WriteString(w, wrapToken(element, attrs, text.String()))
+			text.Reset()
 		}
-		fmt.Fprint(w, f.preWrapper.End(false))
-		fmt.Fprint(w, "</td>\n")
-		fmt.Fprintf(w, "<td%s>\n", f.classAttr(classes, chroma.LineTableTD, "w-full"))
 	}
-
-	fmt.Fprintf(w, "%s", f.preWrapper.Start(true, f.classAttr(classes, chroma.PreWrapper)))
-
-	highlightIndex = 0
-	for index, tokens := range lines {
-		// 1-based line number.
-		line := f.baseLineNumber + index
-		highlight, next := f.shouldHighlight(highlightIndex, line)
-		if next {
-			highlightIndex++
+	for _, token := range tokens {
+		tokenElement, tokenAttrs, tokenText := f.tokenParts(classes, token, line, offset)
+		if tokenElement != element || tokenAttrs != attrs {
+			flush()
+			element, attrs = tokenElement, tokenAttrs
 		}
+		text.WriteString(tokenText)
+		offset += len(token.Value)
+	}
+	flush()
+}
 
-		if !(f.preventSurroundingPre || f.inlineCode) {
-			// Start of Line
-			fmt.Fprint(w, `<span`)
+// wrapToken wraps the escaped text of a token in element with attrs, leaving
+// the text bare if it needs neither.
+func wrapToken(element, attrs, text string) string {
+	if element != "span" {
+		return "<" + element + attrs + ">" + text + "</" + element + ">"
+	}
+	if attrs == "" {
+		return text
+	}
+	return "<span" + attrs + ">" + text + "</span>"
+}
 
-			if highlight {
-				// Line + LineHighlight
-				lineClasses := strings.TrimSpace(strings.Join([]string{
-					classes[chroma.Line],
-					classes[chroma.LineHighlight],
-				}, " "))
-				if lineClasses != "" {
-					fmt.Fprintf(w, ` class="%s"`, lineClasses)
-				}
-				fmt.Fprint(w, `>`)
-			} else {
-				fmt.Fprintf(w, "%s>", f.classAttr(classes, chroma.Line))
-			}
+// tokenParts returns the element, attributes and escaped text of a token.
+func (f *Formatter) tokenParts(classes map[chroma.TokenType]string, token chroma.Token, line, offset int) (element, attrs, text string) {
+	text = html.EscapeString(token.String())
+	switch {
+	case f.assumeEscaped:
+		text = token.String()
+	case f.insertWordBreaks:
+		text = escapeWithWordBreaks(token.String())
+	}
+	attrs = f.tokenTitleAttr(token.Type)
+	isError := f.errorTooltips && token.Type == chroma.Error
+	if isError {
+		attrs = fmt.Sprintf(` title="%s"`, html.EscapeString(f.errorTooltipText))
+	}
+	if f.tokenPositionData {
+		attrs += fmt.Sprintf(` data-start="%d" data-end="%d"`, offset, offset+len(token.Value))
+	}
+	extra := f.whitespaceMarker(token)
+	if isError {
+		extra = joinClasses(extra, errorTooltipClasses)
+	}
+	if f.highlightTokenTypes != nil && tokenTypeIn(token.Type, f.highlightTokenTypes) {
+		extra = joinClasses(extra, f.highlightTokenTypesClass)
+	}
+	if f.highlightTokenFunc != nil {
+		if class, ok := f.highlightTokenFunc(token, line); ok {
+			extra = joinClasses(extra, class)
+		}
+	}
+	if f.shouldWrap(classes, token) {
+		attrs = f.classAttr(classes, token.Type, extra) + f.tokenNameAttr(token.Type) + attrs
+	} else if extra != "" {
+		// Marked tokens are always wrapped, even if plain.
+		attrs = f.utilityAttr(strings.Fields(extra)...) + attrs
+	}
+	if element = f.tokenElement(token.Type); element == "" {
+		element = "span"
+	}
+	return element, attrs, text
+}
 
-			// Line number
-			if f.lineNumbers && !wrapInTable {
-				fmt.Fprintf(w, "<span%s%s>%s</span>", f.classAttr(classes, chroma.LineNumbers), f.lineIDAttribute(line), f.lineTitleWithLinkIfNeeded(classes, lineDigits, line))
-			}
+// errorTooltipClasses mark tokens with ErrorTooltips.
+const errorTooltipClasses = "underline decoration-wavy decoration-red-500"
 
-			fmt.Fprintf(w, `<span%s>`, f.classAttr(classes, chroma.CodeLine))
+// tokenElement returns the WithTokenElements element for tt or its closest
+// parent, or "".
+func (f *Formatter) tokenElement(tt chroma.TokenType) string {
+	if f.tokenElements == nil {
+		return ""
+	}
+	for {
+		if element, ok := f.tokenElements[tt]; ok {
+			return element
 		}
-
-		for _, token := range tokens {
-			html := html.EscapeString(token.String())
-			attr := f.classAttr(classes, token.Type)
-			if attr != "" {
-				html = fmt.Sprintf("<span%s>%s</span>", attr, html)
-			}
-			fmt.Fprint(w, html)
+		parent := tt.Parent()
+		if parent == tt {
+			return ""
 		}
+		tt = parent
+	}
+}
 
-		if !(f.preventSurroundingPre || f.inlineCode) {
-			fmt.Fprint(w, `</span>`) // End of CodeLine
-
-			fmt.Fprint(w, `</span>`) // End of Line
+// customClassesFor returns the WithCustomClasses classes of tt, or of its
+// nearest parent with any.
+func (f *Formatter) customClassesFor(tt chroma.TokenType) []string {
+	if f.customClasses == nil {
+		return nil
+	}
+	for {
+		if classes, ok := f.customClasses[tt]; ok {
+			return classes
 		}
+		parent := tt.Parent()
+		if tt < 0 || parent == tt {
+			return nil
+		}
+		tt = parent
 	}
-	fmt.Fprintf(w, "%s", f.preWrapper.End(true))
+}
 
-	if wrapInTable {
-		fmt.Fprint(w, "</td></tr></table>\n")
-		fmt.Fprint(w, "</div>\n")
+// wordBreakRun is the longest run of characters emitted without a <wbr>.
+const wordBreakRun = 20
+
+// escapeWithWordBreaks escapes text, inserting <wbr> break opportunities
+// between punctuation and a following word, and within long unbroken runs.
+func escapeWithWordBreaks(text string) string {
+	var out strings.Builder
+	run := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		out.WriteString(html.EscapeString(string(r)))
+		if unicode.IsSpace(r) {
+			run = 0
+			continue
+		}
+		run++
+		if i == len(runes)-1 || unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+		next := runes[i+1]
+		afterPunct := strings.ContainsRune("./\\_-:,;()[]{}", r) && (unicode.IsLetter(next) || unicode.IsDigit(next))
+		if run >= wordBreakRun || afterPunct {
+			out.WriteString("<wbr>")
+			run = 0
+		}
 	}
+	return out.String()
+}
 
-	if f.standalone {
-		fmt.Fprint(w, "\n</body>\n")
-		fmt.Fprint(w, "</html>\n")
+func (f *Formatter) tokenNameAttr(tt chroma.TokenType) string {
+	if !f.tokenNameAttribute {
+		return ""
+	}
+	name := shortTokenName(tt)
+	if name == "" {
+		return ""
 	}
+	return fmt.Sprintf(` data-token="%s"`, html.EscapeString(name))
+}
 
-	return nil
+// whitespaceMarker returns the ShowWhitespace class if token is horizontal
+// whitespace.
+func (f *Formatter) whitespaceMarker(token chroma.Token) string {
+	if f.showWhitespace == "" || strings.TrimSpace(token.Value) != "" || !strings.ContainsAny(token.Value, " \t") {
+		return ""
+	}
+	return f.showWhitespace
 }
 
-func (f *Formatter) lineIDAttribute(line int) string {
-	if !f.linkableLineNumbers {
+// tokenTitleAttr returns a title attribute naming tt, when TokenTitles is set.
+func (f *Formatter) tokenTitleAttr(tt chroma.TokenType) string {
+	if !f.tokenTitles {
 		return ""
 	}
-	return fmt.Sprintf(" id=\"%s\"", f.lineID(line))
+	return fmt.Sprintf(` title="%s"`, html.EscapeString(tt.String()))
 }
 
-func (f *Formatter) lineTitleWithLinkIfNeeded(classes map[chroma.TokenType]string, lineDigits, line int) string {
-	title := fmt.Sprintf("%*d", lineDigits, line)
-	if !f.linkableLineNumbers {
-		return title
+// shortTokenName returns chroma's short class name for tt, falling back to its
+// closest parent category with one.
+func shortTokenName(tt chroma.TokenType) string {
+	for {
+		if name, ok := chroma.StandardTypes[tt]; ok {
+			return name
+		}
+		if tt.Parent() == tt {
+			return ""
+		}
+		tt = tt.Parent()
 	}
-	return fmt.Sprintf("<a%s href=\"#%s\">%s</a>", f.classAttr(classes, chroma.LineLink), f.lineID(line), title)
 }
 
-func (f *Formatter) lineID(line int) string {
-	return fmt.Sprintf("%s%d", f.lineNumbersIDPrefix, line)
+func (f *Formatter) shouldWrap(classes map[chroma.TokenType]string, token chroma.Token) bool {
+	if f.wrapOnly != nil && !tokenTypeIn(token.Type, f.wrapOnly) {
+		return false
+	}
+	return !f.omitPlainSpans || !f.isPlainToken(classes, token)
 }
 
-func (f *Formatter) shouldHighlight(highlightIndex, line int) (bool, bool) {
-	next := false
-	for highlightIndex < len(f.highlightRanges) && line > f.highlightRanges[highlightIndex][1] {
-		highlightIndex++
-		next = true
+// tokenTypeIn reports whether tt, or one of its parent categories, is in types.
+func tokenTypeIn(tt chroma.TokenType, types []chroma.TokenType) bool {
+	for {
+		for _, t := range types {
+			if t == tt {
+				return true
+			}
+		}
+		if tt.Parent() == tt {
+			return false
+		}
+		tt = tt.Parent()
 	}
-	if highlightIndex < len(f.highlightRanges) {
-		hrange := f.highlightRanges[highlightIndex]
-		if line >= hrange[0] && line <= hrange[1] {
-			return true, next
+}
+
+// isPlainToken reports whether token can be emitted without a span because its
+// classes are indistinguishable from the inherited default. Whitespace only
+// needs a span for non-colour utilities, and other Text tokens only when they
+// carry classes the background doesn't already provide.
+func (f *Formatter) isPlainToken(classes map[chroma.TokenType]string, token chroma.Token) bool {
+	fields := strings.Fields(classes[token.Type])
+	if strings.TrimSpace(token.Value) == "" {
+		for _, class := range fields {
+			if !f.isTextColourClass(class) {
+				return false
+			}
 		}
+		return true
 	}
-	return false, next
+	if !token.Type.InCategory(chroma.Text) {
+		return len(fields) == 0
+	}
+	inherited := strings.Fields(classes[chroma.Background])
+	for _, class := range fields {
+		found := false
+		for _, bgClass := range inherited {
+			if class == bgClass {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Formatter) isTextColourClass(class string) bool {
+	class = strings.TrimPrefix(class, f.darkVariant())
+	class = strings.TrimPrefix(class, f.prefix)
+	return strings.HasPrefix(class, "text-[")
 }
 
 func (f *Formatter) classAttr(classes map[chroma.TokenType]string, tt chroma.TokenType, extraClasses ...string) string {
@@ -369,37 +3034,176 @@ func (f *Formatter) classAttr(classes map[chroma.TokenType]string, tt chroma.Tok
 			}
 		}
 	}
+	return f.joinedClassAttr(parts...)
+}
+
+// utilityAttr builds a class attribute from unprefixed utilities.
+func (f *Formatter) utilityAttr(utilities ...string) string {
+	return f.joinedClassAttr(f.prefixedClasses(utilities)...)
+}
+
+// transformClasses applies the WithClassTransformer function to classes,
+// dropping those it maps to "".
+func (f *Formatter) transformClasses(classes []string) []string {
+	out := make([]string, 0, len(classes))
+	for _, class := range classes {
+		if class = f.classTransformer(class); class != "" {
+			out = append(out, class)
+		}
+	}
+	return out
+}
+
+// joinedClassAttr builds a class attribute from already prefixed class lists.
+// With SharedClasses, the lists are replaced by their registered short name.
+func (f *Formatter) joinedClassAttr(classLists ...string) string {
+	parts := []string{}
+	for _, classList := range classLists {
+		if classList = strings.TrimSpace(classList); classList != "" {
+			parts = append(parts, classList)
+		}
+	}
+	if f.classTransformer != nil {
+		parts = f.transformClasses(strings.Fields(strings.Join(parts, " ")))
+	}
 	if len(parts) == 0 {
 		return ""
 	}
-	return fmt.Sprintf(` class="%s"`, strings.Join(parts, " "))
+	value := strings.Join(parts, " ")
+	if f.sharedClasses != nil {
+		value = f.sharedClasses.name(value)
+	}
+	return fmt.Sprintf(` class="%s"`, value)
+}
+
+// languageClass returns the unprefixed "lang-<name>" class for the container,
+// if enabled.
+func (f *Formatter) languageClass() string {
+	if !f.languageContainerClass || f.language == "" {
+		return ""
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, f.language)
+	return "lang-" + name
 }
 
 func (f *Formatter) tabWidthClass() string {
-	if f.tabWidth != 0 && f.tabWidth != 8 {
-		return fmt.Sprintf("[tab-size:%d]", f.tabWidth)
+	if f.tabWidthSet && !f.expandTabs {
+		return arbitrary("tab-size", strconv.Itoa(f.tabWidth))
+	}
+	return ""
+}
+
+// whitespaceClass returns the whitespace utility for the code wrapper. Without
+// a surrounding <pre>, whitespace is preserved explicitly unless long lines
+// are being wrapped.
+func (f *Formatter) whitespaceClass() string {
+	if f.whitespace != "" {
+		return f.whitespace
+	}
+	// Without a <pre> the whitespace of the code, including indentation, would
+	// collapse. Within it, it is inherited by the flex lines.
+	if (f.inlineCode || f.preventSurroundingPre || f.nonPreWrapper) && !f.wrapLongLines {
+		return "whitespace-pre"
 	}
 	return ""
 }
 
+// gutterMargin returns the margin of size separating line numbers from the
+// code, on the side facing it.
+func (f *Formatter) gutterMargin(size string) string {
+	if f.lineNumbersRight {
+		return "ml-[" + size + "]"
+	}
+	return "mr-[" + size + "]"
+}
+
+// baseClasses returns the layout utilities of the structural token types, to
+// which the colours of the style are added:
+//
+//   - PreWrapper: grid when lines are highlighted, plus whitespace handling.
+//     A group with AsGroup.
+//   - Line: flex, so the line number and code sit side by side, unless
+//     FlatLines. A named group and peer with AsGroup.
+//   - CodeLine: grow, so the code fills the rest of the line. A hanging indent
+//     with WrapIndent.
+//   - LineNumbers, LineNumbersTable: unselectable, padded numbers.
+//   - LineTable, LineTableTD: a borderless table with top aligned cells.
+//   - LineLink: links that look like the plain line number.
+//
+// Background, LineHighlight and Error only have the colours of the style.
 func (f *Formatter) baseClasses(tt chroma.TokenType) []string {
 	switch tt {
 	case chroma.PreWrapper:
 		classes := []string{}
-		if len(f.highlightRanges) > 0 {
+		if f.hasHighlights() && f.highlightLayout != HighlightLayoutBlock {
 			classes = append(classes, "grid")
 		}
-		if f.wrapLongLines {
+		if f.asGroup {
+			classes = append(classes, "group")
+		}
+		if f.wrapLongLines && f.wrapLines == nil {
 			classes = append(classes, "whitespace-pre-wrap", "break-words")
 		}
+		if ws := f.whitespaceClass(); ws != "" {
+			classes = append(classes, ws)
+		}
+		if f.scrollSnap {
+			classes = append(classes, "overflow-x-auto", "snap-x", "snap-mandatory")
+		}
+		if f.printBackground {
+			classes = append(classes, arbitrary("-webkit-print-color-adjust", "exact"), arbitrary("print-color-adjust", "exact"))
+		}
 		return classes
 	case chroma.Line:
-		return []string{"flex"}
-	case chroma.LineNumbers, chroma.LineNumbersTable:
-		return []string{"whitespace-pre", "select-none", "mr-[0.4em]", "px-[0.4em]"}
+		classes := []string{}
+		if !f.flatLines {
+			classes = append(classes, "flex")
+		}
+		if f.hasHighlights() {
+			if f.highlightLayout == HighlightLayoutBlock {
+				classes = append(classes, "w-full")
+			} else {
+				// Each line spans the full grid column so highlights are edge-to-edge.
+				classes = append(classes, "col-span-full")
+			}
+		}
+		if f.asGroup {
+			classes = append(classes, "group/line", "peer")
+		}
+		classes = append(classes, strings.Fields(f.focusTransition)...)
+		if f.contentVisibilityAuto {
+			// Offscreen lines are assumed to be one line high until rendered.
+			classes = append(classes, arbitrary("content-visibility", "auto"), arbitrary("contain-intrinsic-size", "auto 1lh"))
+		}
+		return classes
+	case chroma.CodeLine:
+		classes := []string{"grow"}
+		if f.wrapIndent != "" && (f.wrapLongLines || f.wrapLines != nil) {
+			// The first row is shifted back by as much as the rest are indented.
+			classes = append(classes, arbitraryValue("pl", f.wrapIndent), arbitraryValue("-indent", f.wrapIndent))
+		}
+		return classes
+	case chroma.LineNumbersTable:
+		if f.compactGutter {
+			return []string{"whitespace-pre", "select-none", f.gutterMargin("0.2em"), "px-[0.2em]"}
+		}
+		return []string{"whitespace-pre", "select-none", f.gutterMargin("0.4em"), "px-[0.4em]"}
+	case chroma.LineNumbers:
+		return []string{"whitespace-pre", "select-none", f.gutterMargin("0.4em"), "px-[0.4em]"}
 	case chroma.LineTable:
+		if f.tableClasses != "" {
+			return strings.Fields(f.tableClasses)
+		}
 		return []string{"border-separate", "border-spacing-0", "p-0", "m-0", "border-0"}
 	case chroma.LineTableTD:
+		if f.tableCellClasses != "" {
+			return strings.Fields(f.tableCellClasses)
+		}
 		return []string{"align-top", "p-0", "m-0", "border-0"}
 	case chroma.LineLink:
 		return []string{"outline-none", "no-underline", "text-[inherit]"}
@@ -407,14 +3211,74 @@ func (f *Formatter) baseClasses(tt chroma.TokenType) []string {
 	return nil
 }
 
+// classes compiles the classes for light and dark. Without a distinct dark
+// style the dark: variants would repeat the light classes, so they are only
+// emitted for a dark style or NeutralDark.
+// With WithClasses, each list of utilities is replaced by its semantic class.
 func (f *Formatter) classes(light, dark *chroma.Style) map[chroma.TokenType]string {
+	classes := f.utilityClasses(light, dark)
+	if f.withClasses {
+		for tt, utilities := range classes {
+			if semantic := f.semanticClass(tt); utilities != "" && semantic != "" {
+				classes[tt] = semantic
+			}
+		}
+	}
+	return classes
+}
+
+// utilityClasses compiles the utilities for light and dark.
+func (f *Formatter) utilityClasses(light, dark *chroma.Style) map[chroma.TokenType]string {
+	darkVariants := (dark != nil && dark != light) || (f.neutralDark && f.darkStyle == nil)
+	return f.compileClasses(light, dark, darkVariants && !f.separateThemeClasses)
+}
+
+// CodeClasses returns the classes the formatter applies to the element wrapping
+// the code, including the theme background. This is useful when supplying your
+// own <pre> via PreventSurroundingPre or WithPreWrapper.
+func (f *Formatter) CodeClasses(light, dark *chroma.Style) string {
+	return f.classCache.get(light, dark)[chroma.PreWrapper]
+}
+
+// Classes returns the classes the formatter applies to each token type, eg.
+// chroma.Keyword, for callers writing their own markup. They are the class
+// attributes Format writes, before any WithClassTransformer or SharedClasses
+// rewriting. The map is a copy, which the caller may modify.
+func (f *Formatter) Classes(light, dark *chroma.Style) map[chroma.TokenType]string {
+	return maps.Clone(f.classCache.get(light, dark))
+}
+
+// ThemeClasses returns separate class maps for the light and dark styles, each
+// using plain utilities with no dark: variants. Combined with
+// SeparateThemeClasses, a front-end can switch themes by replacing the class
+// lists of the rendered elements.
+func (f *Formatter) ThemeClasses(light, dark *chroma.Style) (lightClasses, darkClasses map[chroma.TokenType]string) {
+	if dark == nil {
+		dark = light
+	}
+	return f.compileClasses(light, light, false), f.compileClasses(dark, dark, false)
+}
+
+// standardTypes returns the keys of chroma.StandardTypes in ascending order,
+// so that everything generated from them is deterministic.
+var standardTypes = sync.OnceValue(func() []chroma.TokenType {
+	tts := make([]chroma.TokenType, 0, len(chroma.StandardTypes))
+	for tt := range chroma.StandardTypes {
+		tts = append(tts, tt)
+	}
+	slices.Sort(tts)
+	return tts
+})
+
+func (f *Formatter) compileClasses(light, dark *chroma.Style, darkVariants bool) map[chroma.TokenType]string {
 	if dark == nil {
 		dark = light
 	}
 	classes := map[chroma.TokenType]string{}
 	bgLight := light.Get(chroma.Background)
 	bgDark := dark.Get(chroma.Background)
-	for t := range chroma.StandardTypes {
+	neutralDark := darkVariants && f.neutralDark && f.darkStyle == nil
+	for _, t := range standardTypes() {
 		lightEntry := light.Get(t)
 		darkEntry := dark.Get(t)
 		if t != chroma.Background {
@@ -422,22 +3286,160 @@ func (f *Formatter) classes(light, dark *chroma.Style) map[chroma.TokenType]stri
 			darkEntry = darkEntry.Sub(bgDark)
 		}
 
-		lightValues := entryValuesFrom(lightEntry)
-		darkValues := entryValuesFrom(darkEntry)
+		lightValues := f.entryValuesFrom(lightEntry)
+		darkValues := f.entryValuesFrom(darkEntry)
+		lightColour := lightEntry.Colour
+		// The entries have lost their noinherit flags to Sub.
+		if c := resetColour(light, light.Get(t)); c.IsSet() {
+			lightValues.text = f.colourUtility("text", c)
+			lightColour = c
+		}
+		if c := resetColour(dark, dark.Get(t)); c.IsSet() {
+			darkValues.text = f.colourUtility("text", c)
+		}
+		if c := f.contrastFallback(light, t); c.IsSet() {
+			lightValues.text = f.colourUtility("text", c)
+			lightColour = c
+		}
+		if c := f.contrastFallback(dark, t); c.IsSet() {
+			darkValues.text = f.colourUtility("text", c)
+		}
+		if neutralDark {
+			darkValues = lightValues
+			darkValues.text, darkValues.bg = "", ""
+			if t == chroma.Background {
+				darkValues.bg = f.neutralDarkBackground
+			}
+		}
+		if f.darkBackgroundFallback && lightValues.bg != "" && darkValues.bg == "" && bgDark.Background.IsSet() {
+			// Tint the dark background rather than going transparent, in the same way
+			// chroma synthesises line highlights.
+			darkValues.bg = f.colourUtility("bg", bgDark.Background.BrightenOrDarken(0.1))
+		}
+		if f.backgroundAlpha >= 0 && f.backgroundAlpha < 100 && tokenTypeIn(t, overlayTypes) {
+			lightValues.bg = withAlpha(lightValues.bg, f.backgroundAlpha)
+			darkValues.bg = withAlpha(darkValues.bg, f.backgroundAlpha)
+		}
 
-		parts := []string{}
-		parts = append(parts, f.prefixedClasses(f.baseClasses(t))...)
-		parts = append(parts, lightValues.classes(f.prefix)...)
-		parts = append(parts, f.darkVariantClasses(lightValues, darkValues)...)
-		classes[t] = strings.Join(parts, " ")
+		parts := classParts{layout: f.prefixedClasses(f.baseClasses(t))}
+		if f.tokenColorVariables && (lightValues.text != "" || darkValues.text != "") {
+			// The variable is redefined per theme, so no dark: variant is needed.
+			parts.colours = append(parts.colours, prefixClass(f.prefix, arbitraryValue("text", "color:var("+tokenColorVariable(t)+")")))
+			lightValues.text, darkValues.text = "", ""
+		}
+		if f.tokenColorVariables && (lightValues.bg != "" || darkValues.bg != "") {
+			parts.colours = append(parts.colours, prefixClass(f.prefix, arbitraryValue("bg", "color:var("+tokenBackgroundVariable(t)+")")))
+			lightValues.bg, darkValues.bg = "", ""
+		}
+		parts.colours = append(parts.colours, lightValues.classes(f.prefix, f.boldClass)...)
+		if darkVariants {
+			parts.variants = append(parts.variants, f.darkVariantClasses(lightValues, darkValues)...)
+		}
+		if f.printColors {
+			if t == chroma.Background && !lightColour.IsSet() {
+				// The text would otherwise be that of the page.
+				lightColour = chroma.MustParseColour("#000000")
+			}
+			parts.variants = append(parts.variants, f.printVariantClasses(lightColour, lightValues, darkValues)...)
+		}
+		if f.dimClass != "" && tokenTypeIn(t, []chroma.TokenType{f.dimType}) {
+			parts.options = append(parts.options, f.prefixedClasses(strings.Fields(f.dimClass))...)
+		}
+		parts.options = append(parts.options, f.prefixedClasses(strings.Fields(strings.Join(f.customClassesFor(t), " ")))...)
+		classes[t] = parts.join(f.classOrder)
 	}
+	if f.classOrder == ClassOrderColourFirst {
+		classes[chroma.PreWrapper] = joinClasses(classes[chroma.Background], classes[chroma.PreWrapper])
+	} else {
+		classes[chroma.PreWrapper] = joinClasses(classes[chroma.PreWrapper], classes[chroma.Background])
+	}
+	classes[chroma.PreWrapper] = joinClasses(classes[chroma.PreWrapper], f.languageClass())
+	if f.inlineCode && !f.inlineCodeBare {
+		inline := f.prefixedClasses(append(strings.Fields(f.inlineRounding), strings.Fields(f.inlinePadding)...))
+		classes[chroma.PreWrapper] = joinClasses(classes[chroma.PreWrapper], strings.Join(inline, " "))
+	}
+	// The tab size goes on the elements directly containing the code, rather
+	// than relying on it being inherited from the background, so that it also
+	// applies in table mode and when the surrounding <pre> is omitted.
 	if tabClass := f.tabWidthClass(); tabClass != "" {
-		classes[chroma.Background] = joinClasses(classes[chroma.Background], prefixClass(f.prefix, tabClass))
+		tabClass = prefixClass(f.prefix, tabClass)
+		classes[chroma.PreWrapper] = joinClasses(classes[chroma.PreWrapper], tabClass)
+		classes[chroma.CodeLine] = joinClasses(classes[chroma.CodeLine], tabClass)
 	}
-	classes[chroma.PreWrapper] = joinClasses(classes[chroma.PreWrapper], classes[chroma.Background])
 	return classes
 }
 
+// classParts are the classes of a token type, by group, joined in the order
+// documented by ClassOrder so that the classes of an element only change
+// position when they change group. Within a group, the order is fixed:
+//
+//   - layout: the base classes, in the order of baseClasses.
+//   - colours: text colour, background, bold, italic, underline.
+//   - variants: the dark: variants, in the same order, then print: variants.
+//   - options: DimTokens, then WithCustomClasses.
+type classParts struct {
+	layout, colours, variants, options []string
+}
+
+// join returns the classes of parts as an attribute value, in order.
+func (p classParts) join(order string) string {
+	groups := [][]string{p.layout, p.colours, p.variants, p.options}
+	if order == ClassOrderColourFirst {
+		groups = [][]string{p.colours, p.variants, p.layout, p.options}
+	}
+	return strings.Join(slices.Concat(groups...), " ")
+}
+
+// overlayTypes are the token types whose backgrounds are given BackgroundAlpha.
+var overlayTypes = []chroma.TokenType{chroma.LineHighlight, chroma.GenericInserted, chroma.GenericDeleted}
+
+// withAlpha returns the colour utility with the opacity modifier for percent,
+// eg. "bg-[#ffebe9]/20".
+func withAlpha(utility string, percent int) string {
+	if utility == "" {
+		return ""
+	}
+	return utility + "/" + strconv.Itoa(percent)
+}
+
+// lineWrapperTypes are the meta types of the elements enclosing the tokens of
+// a line.
+var lineWrapperTypes = []chroma.TokenType{chroma.Line, chroma.CodeLine, chroma.LineHighlight}
+
+// resetColour returns the colour given to entry, of style, if it is marked
+// noinherit and has no colour of its own, or an unset colour.
+//
+// Such a token should have the colour of the code background rather than that
+// of any of its parent types. As it would otherwise take the colour of the
+// elements wrapping its line, it is reset where one of those sets another.
+func resetColour(style *chroma.Style, entry chroma.StyleEntry) chroma.Colour {
+	if !entry.NoInherit || entry.Colour.IsSet() {
+		return 0
+	}
+	colour := style.Get(chroma.Background).Colour
+	if !colour.IsSet() {
+		return 0
+	}
+	for _, t := range lineWrapperTypes {
+		if wrapper := style.Get(t).Colour; wrapper.IsSet() && wrapper != colour {
+			return colour
+		}
+	}
+	return 0
+}
+
+// tokenColorVariable returns the name of the CSS variable holding the text
+// colour of tt with TokenColorVariables, eg. "--t-k".
+func tokenColorVariable(tt chroma.TokenType) string {
+	return "--t-" + chroma.StandardTypes[tt]
+}
+
+// tokenBackgroundVariable returns the name of the CSS variable holding the
+// background colour of tt with TokenColorVariables, eg. "--t-bg-bg".
+func tokenBackgroundVariable(tt chroma.TokenType) string {
+	return tokenColorVariable(tt) + "-bg"
+}
+
 type entryValues struct {
 	text      string
 	bg        string
@@ -446,27 +3448,27 @@ type entryValues struct {
 	underline bool
 }
 
-func entryValuesFrom(entry chroma.StyleEntry) entryValues {
+func (f *Formatter) entryValuesFrom(entry chroma.StyleEntry) entryValues {
 	out := entryValues{}
 	if entry.Colour.IsSet() {
-		out.text = "text-[" + entry.Colour.String() + "]"
+		out.text = f.colourUtility("text", entry.Colour)
 	}
 	if entry.Background.IsSet() {
-		out.bg = "bg-[" + entry.Background.String() + "]"
+		out.bg = f.colourUtility("bg", entry.Background)
 	}
-	if entry.Bold == chroma.Yes {
+	if entry.Bold == chroma.Yes && f.boldClass != "" {
 		out.bold = true
 	}
-	if entry.Italic == chroma.Yes {
+	if entry.Italic == chroma.Yes && !f.suppressEmphasis {
 		out.italic = true
 	}
-	if entry.Underline == chroma.Yes {
+	if entry.Underline == chroma.Yes && !f.suppressEmphasis {
 		out.underline = true
 	}
 	return out
 }
 
-func (e entryValues) classes(prefix string) []string {
+func (e entryValues) classes(prefix, boldClass string) []string {
 	out := []string{}
 	if e.text != "" {
 		out = append(out, prefixClass(prefix, e.text))
@@ -475,7 +3477,7 @@ func (e entryValues) classes(prefix string) []string {
 		out = append(out, prefixClass(prefix, e.bg))
 	}
 	if e.bold {
-		out = append(out, prefixClass(prefix, "font-bold"))
+		out = append(out, prefixClass(prefix, boldClass))
 	}
 	if e.italic {
 		out = append(out, prefixClass(prefix, "italic"))
@@ -486,38 +3488,73 @@ func (e entryValues) classes(prefix string) []string {
 	return out
 }
 
+// darkVariantClasses returns the dark variants overriding the light values
+// where the dark ones differ. Values shared by both are left to the light
+// classes.
 func (f *Formatter) darkVariantClasses(light, dark entryValues) []string {
 	out := []string{}
-	if dark.text != "" {
+	switch {
+	case dark.text == light.text:
+	case dark.text != "":
 		out = append(out, f.darkClass(dark.text))
-	} else if light.text != "" {
+	default:
 		out = append(out, f.darkClass("text-[inherit]"))
 	}
-	if dark.bg != "" {
+	switch {
+	case dark.bg == light.bg:
+	case dark.bg != "":
 		out = append(out, f.darkClass(dark.bg))
-	} else if light.bg != "" {
+	default:
 		out = append(out, f.darkClass("bg-transparent"))
 	}
-	if dark.bold {
-		out = append(out, f.darkClass("font-bold"))
-	} else if light.bold {
+	if dark.bold && !light.bold {
+		out = append(out, f.darkClass(f.boldClass))
+	} else if light.bold && !dark.bold {
 		out = append(out, f.darkClass("font-normal"))
 	}
-	if dark.italic {
+	if dark.italic && !light.italic {
 		out = append(out, f.darkClass("italic"))
-	} else if light.italic {
+	} else if light.italic && !dark.italic {
 		out = append(out, f.darkClass("not-italic"))
 	}
-	if dark.underline {
+	if dark.underline && !light.underline {
 		out = append(out, f.darkClass("underline"))
-	} else if light.underline {
+	} else if light.underline && !dark.underline {
 		out = append(out, f.darkClass("no-underline"))
 	}
 	return out
 }
 
+// printMaxBrightness is the brightness text colours are clamped to by
+// PrintColors, keeping them legible on paper.
+const printMaxBrightness = 0.4
+
+// printVariantClasses returns the print: variants of PrintColors for a token
+// with the light text colour, given its light and dark values.
+func (f *Formatter) printVariantClasses(colour chroma.Colour, light, dark entryValues) []string {
+	out := []string{}
+	switch {
+	case colour.IsSet():
+		out = append(out, "print:"+prefixClass(f.prefix, f.colourUtility("text", colour.ClampBrightness(0, printMaxBrightness))))
+	case dark.text != "":
+		out = append(out, "print:"+prefixClass(f.prefix, "text-[inherit]"))
+	}
+	if light.bg != "" || dark.bg != "" {
+		out = append(out, "print:"+prefixClass(f.prefix, "bg-transparent"))
+	}
+	return out
+}
+
 func (f *Formatter) darkClass(class string) string {
-	return "dark:" + prefixClass(f.prefix, class)
+	return f.darkVariant() + prefixClass(f.prefix, class)
+}
+
+// darkVariant returns the variant applying dark styles for DarkModeStrategy.
+func (f *Formatter) darkVariant() string {
+	if f.darkModeStrategy == DarkModeMedia {
+		return "[@media(prefers-color-scheme:dark)]:"
+	}
+	return "dark:"
 }
 
 func (f *Formatter) prefixedClasses(classes []string) []string {
@@ -531,11 +3568,44 @@ func (f *Formatter) prefixedClasses(classes []string) []string {
 	return out
 }
 
+// arbitrary returns a Tailwind arbitrary property utility, eg. [tab-size:4].
+func arbitrary(property, value string) string {
+	return "[" + property + ":" + encodeArbitrary(value) + "]"
+}
+
+// arbitraryValue returns a utility with an arbitrary value, eg. text-[#fff].
+func arbitraryValue(utility, value string) string {
+	return utility + "-[" + encodeArbitrary(value) + "]"
+}
+
+// encodeArbitrary encodes value for use inside a Tailwind arbitrary value,
+// where whitespace must be written as underscores and literal underscores
+// escaped.
+func encodeArbitrary(value string) string {
+	value = strings.ReplaceAll(value, "_", `\_`)
+	return strings.Join(strings.Fields(value), "_")
+}
+
+// prefixClass prefixes the utility of class, after any variants, as Tailwind
+// expects (eg. "group-open:hidden" becomes "group-open:tw-hidden").
 func prefixClass(prefix, class string) string {
 	if prefix == "" {
 		return class
 	}
-	return prefix + class
+	utility, depth := 0, 0
+	for i, r := range class {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				utility = i + 1
+			}
+		}
+	}
+	return class[:utility] + prefix + class[utility:]
 }
 
 func joinClasses(a, b string) string {
@@ -548,31 +3618,116 @@ func joinClasses(a, b string) string {
 	return a + " " + b
 }
 
+// classCacheLimit is the default number of entries in the class cache.
 const classCacheLimit = 32
 
 type classCacheEntry struct {
-	light *chroma.Style
-	dark  *chroma.Style
-	cache map[chroma.TokenType]string
+	light  *chroma.Style
+	dark   *chroma.Style
+	prefix string
+	cache  map[chroma.TokenType]string
+	size   int
+	// hash is the StyleHash of the entry, once computed.
+	hash string
+}
+
+// classMapOverhead approximates the memory used by a class map entry in
+// addition to the bytes of its class string.
+const classMapOverhead = 32
+
+// classMapSize estimates the memory used by a compiled class map.
+func classMapSize(classes map[chroma.TokenType]string) int {
+	size := 0
+	for _, class := range classes {
+		size += classMapOverhead + len(class)
+	}
+	return size
+}
+
+// CacheStats holds counters describing the effectiveness of the class cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CacheStats returns the hit, miss and eviction counts of the formatter's
+// class cache.
+func (f *Formatter) CacheStats() CacheStats {
+	f.classCache.mu.Lock()
+	defer f.classCache.mu.Unlock()
+	return f.classCache.stats
+}
+
+// ClearCache discards all compiled class maps, releasing references to the
+// styles they were compiled from. Cache statistics are preserved.
+func (f *Formatter) ClearCache() {
+	f.classCache.mu.Lock()
+	defer f.classCache.mu.Unlock()
+	f.classCache.cache = nil
+	f.classCache.size = 0
 }
 
+// classCache is the class cache of a formatter. The copies made by
+// FormatWithPrefix share the store of the formatter they were made from.
 type classCache struct {
+	*classStore
+	f *Formatter
+}
+
+type classStore struct {
 	mu sync.Mutex
 	// LRU cache of compiled styles. This is a slice
-	// because the cache size is small, and a slice is sufficiently fast for
-	// small N.
+	// because the cache size is usually small, and a slice is sufficiently
+	// fast for small N.
 	cache []classCacheEntry
-	f     *Formatter
+	size  int // Estimated total size of the cached class maps.
+	stats CacheStats
 }
 
 func newClassCache(f *Formatter) *classCache {
-	return &classCache{f: f}
+	return &classCache{classStore: &classStore{}, f: f}
+}
+
+// sameStyle reports whether a and b compile to the same classes. Styles are
+// compared by identity, or by name when CacheByStyleName is enabled, in which
+// case the entries are also compared to guard against name collisions.
+func (c *classCache) sameStyle(a, b *chroma.Style) bool {
+	if a == b {
+		return true
+	}
+	if !c.f.cacheByStyleName || a == nil || b == nil || a.Name == "" || a.Name != b.Name {
+		return false
+	}
+	for _, t := range standardTypes() {
+		if a.Get(t) != b.Get(t) {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *classCache) get(light, dark *chroma.Style) map[chroma.TokenType]string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.entry(light, dark).cache
+}
+
+// styleHash returns the StyleHash of light and dark, computed from the classes
+// by fn on the first call and kept with them.
+func (c *classCache) styleHash(light, dark *chroma.Style, fn func(classes map[chroma.TokenType]string) string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entry(light, dark)
+	if entry.hash == "" {
+		entry.hash = fn(entry.cache)
+	}
+	return entry.hash
+}
 
+// entry returns the entry for light and dark, compiling it on a miss, after
+// moving it to the end of the LRU. c.mu must be held.
+func (c *classCache) entry(light, dark *chroma.Style) *classCacheEntry {
 	if dark == nil {
 		dark = light
 	}
@@ -580,25 +3735,36 @@ func (c *classCache) get(light, dark *chroma.Style) map[chroma.TokenType]string
 	// Look for an existing entry.
 	for i := len(c.cache) - 1; i >= 0; i-- {
 		entry := c.cache[i]
-		if entry.light == light && entry.dark == dark {
-			// Top of the cache, no need to adjust the order.
-			if i == len(c.cache)-1 {
-				return entry.cache
+		if entry.prefix == c.f.prefix && c.sameStyle(entry.light, light) && c.sameStyle(entry.dark, dark) {
+			c.stats.Hits++
+			// Move this entry to the end of the LRU, unless it is already there.
+			if i != len(c.cache)-1 {
+				copy(c.cache[i:], c.cache[i+1:])
+				c.cache[len(c.cache)-1] = entry
 			}
-			// Move this entry to the end of the LRU
-			copy(c.cache[i:], c.cache[i+1:])
-			c.cache[len(c.cache)-1] = entry
-			return entry.cache
+			return &c.cache[len(c.cache)-1]
 		}
 	}
 
 	// No entry, create one.
+	c.stats.Misses++
 	cached := c.f.classes(light, dark)
 
 	// Evict the oldest entry.
-	if len(c.cache) >= classCacheLimit {
-		c.cache = c.cache[0:copy(c.cache, c.cache[1:])]
+	if limit := c.f.classCacheSize; limit > 0 && len(c.cache) >= limit {
+		c.evictOldest()
+	}
+	entry := classCacheEntry{light: light, dark: dark, prefix: c.f.prefix, cache: cached, size: classMapSize(cached)}
+	c.cache = append(c.cache, entry)
+	c.size += entry.size
+	for budget := c.f.cacheMemoryBudget; budget > 0 && c.size > budget && len(c.cache) > 1; {
+		c.evictOldest()
 	}
-	c.cache = append(c.cache, classCacheEntry{light: light, dark: dark, cache: cached})
-	return cached
+	return &c.cache[len(c.cache)-1]
+}
+
+func (c *classCache) evictOldest() {
+	c.stats.Evictions++
+	c.size -= c.cache[0].size
+	c.cache = c.cache[0:copy(c.cache, c.cache[1:])]
 }
@@ -1,8 +1,15 @@
 package tailwind
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -44,3 +51,1562 @@ func TestTailwindFormatterGitHubDark(t *testing.T) {
 	assert.Contains(t, out, fmt.Sprintf("bg-[%s]", lightBG.String()))
 	assert.Contains(t, out, fmt.Sprintf("dark:bg-[%s]", darkBG.String()))
 }
+
+func format(t *testing.T, source string, options ...Option) string {
+	t.Helper()
+	it, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	out, err := New(options...).FormatString(styles.Get("github"), it)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestFormatString(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	all := tokens.Tokens()
+	for _, options := range [][]Option{nil, {WithLineNumbers(true), HighlightLines([][2]int{{3, 3}})}} {
+		formatter := New(options...)
+		var buf bytes.Buffer
+		assert.NoError(t, formatter.Format(&buf, styles.Get("github"), chroma.Literator(all...)))
+		out, err := formatter.FormatString(styles.Get("github"), chroma.Literator(all...))
+		assert.NoError(t, err)
+		assert.Equal(t, buf.String(), out)
+	}
+}
+
+func TestOmitPlainSpans(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source)
+	assert.Contains(t, out, `<span class="text-[#ffffff]`)
+
+	out = format(t, source, OmitPlainSpans(true))
+	assert.NotContains(t, out, `<span class="text-[#ffffff]`)
+	assert.Contains(t, out, `package</span> <span`)
+	assert.Contains(t, out, `<span class="text-[#1f2328]">main</span>`)
+}
+
+func TestWrapOnly(t *testing.T) {
+	out := format(t, "package main\n\n// hi\nvar s = \"x\"\n", WrapOnly(chroma.Keyword, chroma.Comment))
+	assert.Contains(t, out, `">package</span>`)
+	assert.Contains(t, out, `">var</span>`)
+	assert.Contains(t, out, `">// hi</span>`)
+	assert.Contains(t, out, "</span> main\n")
+	assert.Contains(t, out, `&#34;x&#34;`)
+	assert.NotContains(t, out, `">&#34;x&#34;</span>`)
+	assert.NotContains(t, out, `">main</span>`)
+}
+
+func TestLineWindows(t *testing.T) {
+	source := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n\tfmt.Println(2)\n}\n"
+	windows, err := ParseLineRanges("5-6,1")
+	assert.NoError(t, err)
+	out := format(t, source, LineWindows(windows), WithLineNumbers(true))
+	assert.Contains(t, out, ">1</span>")
+	assert.NotContains(t, out, ">2</span>")
+	assert.NotContains(t, out, "import")
+	assert.Contains(t, out, ">5</span>")
+	assert.Contains(t, out, ">6</span>")
+	assert.Equal(t, 1, strings.Count(out, defaultGapMarker))
+
+	out = format(t, source, LineWindows(windows), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Equal(t, 1, strings.Count(out, defaultGapMarker))
+	assert.Equal(t, 4, strings.Count(out, "select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]\">"))
+}
+
+func TestZeroBasedLines(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, ZeroBasedLines(true), HighlightLines([][2]int{{0, 0}}), WithLineNumbers(true), WithLinkableLineNumbers(true, "L"))
+	lines := strings.Split(out, "<span class=\"flex")
+	assert.Equal(t, 4, len(lines))
+	assert.Contains(t, lines[1], "bg-[#")
+	assert.Contains(t, lines[1], `id="L0"`)
+	assert.Contains(t, lines[1], `href="#L0">0</a>`)
+	assert.NotContains(t, lines[2], "bg-[#")
+	assert.Contains(t, lines[3], `href="#L2">2</a>`)
+
+	out = format(t, source, ZeroBasedLines(true), BaseLineNumber(10), WithLineNumbers(true))
+	assert.Contains(t, out, ">10</span>")
+}
+
+func TestTokenNameAttribute(t *testing.T) {
+	out := format(t, "package main\n", TokenNameAttribute(true))
+	assert.Contains(t, out, fmt.Sprintf(`data-token="%s">package</span>`, chroma.StandardTypes[chroma.KeywordNamespace]))
+	assert.Contains(t, out, `class="text-[#cf222e]" data-token="kn">package</span>`)
+	assert.NotContains(t, format(t, "package main\n"), "data-token")
+}
+
+func TestScrollSnap(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source, ScrollSnap(true), HighlightLines([][2]int{{3, 4}}))
+	assert.Contains(t, out, `<pre class="grid overflow-x-auto snap-x snap-mandatory bg-[#f7f7f7]`)
+	assert.Equal(t, 2, strings.Count(out, "snap-start"))
+	assert.NotContains(t, format(t, source), "snap-")
+}
+
+func TestStandaloneTitleRegion(t *testing.T) {
+	out := format(t, "package main\n", Standalone(true), StandaloneTitle(`main.go <"demo">`))
+	assert.Contains(t, out, "<div role=\"region\" aria-label=\"main.go &lt;&#34;demo&#34;&gt;\">\n<pre")
+	assert.Contains(t, out, "</pre>\n</div>\n</body>")
+	assert.NotContains(t, format(t, "package main\n", Standalone(true)), `role="region"`)
+}
+
+func TestSeparateThemeClasses(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	formatter := New(WithDarkStyle(dark), SeparateThemeClasses(true))
+	lightClasses, darkClasses := formatter.ThemeClasses(light, dark)
+	for tt, cls := range lightClasses {
+		assert.NotContains(t, cls, "dark:", tt.String())
+	}
+	for tt, cls := range darkClasses {
+		assert.NotContains(t, cls, "dark:", tt.String())
+	}
+	assert.Equal(t, "text-[#cf222e]", lightClasses[chroma.Keyword])
+	assert.Equal(t, "text-[#ff7b72]", darkClasses[chroma.Keyword])
+
+	it, err := lexers.Get("go").Tokenise(nil, "package main\n")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, formatter.Format(&buf, light, it))
+	assert.NotContains(t, buf.String(), "dark:")
+	assert.Contains(t, buf.String(), `<span class="text-[#cf222e]">package</span>`)
+}
+
+func TestTabWidth(t *testing.T) {
+	source := "package main\n"
+	assert.Contains(t, format(t, source, TabWidth(4)), "[tab-size:4]")
+	assert.Contains(t, format(t, source, TabWidth(8)), "[tab-size:8]")
+	assert.NotContains(t, format(t, source), "tab-size")
+}
+
+func TestTabWidthInTable(t *testing.T) {
+	out := format(t, "func main() {\n\tx()\n}\n", TabWidth(4), WithLineNumbers(true), LineNumbersInTable(true))
+	_, code, ok := strings.Cut(out, `<td class="align-top p-0 m-0 border-0 w-full">`)
+	assert.True(t, ok)
+	assert.Contains(t, code, `<pre class="bg-[#f7f7f7] [tab-size:4]">`)
+	assert.Contains(t, code, `<span class="grow [tab-size:4]">`)
+	assert.NotContains(t, format(t, "x\n", TabWidth(4), Standalone(true)), `<body class="bg-[#f7f7f7] [tab-size:4]">`)
+}
+
+func TestLinesAsListItems(t *testing.T) {
+	out := format(t, "package main\n\nfunc main() {}\n", LinesAsListItems(true))
+	assert.Contains(t, out, `<pre class="bg-[#f7f7f7]"><code><ol class="list-none m-0 p-0"><li class="flex">`)
+	assert.Equal(t, 3, strings.Count(out, `<li class="flex">`))
+	assert.Equal(t, 3, strings.Count(out, `</li>`))
+	assert.Contains(t, out, "</li></ol></code></pre>")
+}
+
+func TestPrintBackground(t *testing.T) {
+	out := format(t, "package main\n", PrintBackground(true))
+	assert.Contains(t, out, `<pre class="[-webkit-print-color-adjust:exact] [print-color-adjust:exact] bg-[#f7f7f7]`)
+	assert.NotContains(t, format(t, "package main\n"), "print-color-adjust")
+}
+
+func TestArbitrary(t *testing.T) {
+	assert.Equal(t, "[font-family:ui-monospace,_monospace]", arbitrary("font-family", "ui-monospace, monospace"))
+	assert.Equal(t, "[tab-size:4]", arbitrary("tab-size", "4"))
+	assert.Equal(t, "text-[rgb(1_2_3)]", arbitraryValue("text", "rgb(1 2  3)"))
+	assert.Equal(t, `[grid-area:a\_b]`, arbitrary("grid-area", "a_b"))
+}
+
+func TestHighlightGridLines(t *testing.T) {
+	out := format(t, "package main\n\nfunc main() {}\n", HighlightLines([][2]int{{2, 2}}))
+	assert.Contains(t, out, `<pre class="grid `)
+	assert.Equal(t, 3, strings.Count(out, `<span class="flex col-span-full`))
+	assert.NotContains(t, format(t, "package main\n"), "col-span-full")
+}
+
+func TestHighlightLayout(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	highlight := HighlightLines([][2]int{{2, 2}})
+	for _, out := range []string{format(t, source, highlight), format(t, source, highlight, HighlightLayout(HighlightLayoutGrid))} {
+		assert.Contains(t, out, `<pre class="grid `)
+		assert.Contains(t, out, `<span class="flex col-span-full`)
+	}
+
+	out := format(t, source, highlight, HighlightLayout(HighlightLayoutBlock))
+	assert.NotContains(t, out, "grid")
+	assert.NotContains(t, out, "col-span-full")
+	assert.Equal(t, 3, strings.Count(out, `<span class="flex w-full`))
+}
+
+func TestDarkBackgroundFallback(t *testing.T) {
+	light, err := styles.Get("github").Builder().Add(chroma.GenericInserted, "bg:#ddffdd").Build()
+	assert.NoError(t, err)
+	dark := chroma.MustNewStyle("dark", chroma.StyleEntries{chroma.Background: "#ffffff bg:#000000"})
+
+	classes := New(WithDarkStyle(dark)).classes(light, dark)
+	assert.Contains(t, classes[chroma.GenericInserted], "bg-[#ddffdd] dark:bg-transparent")
+
+	classes = New(WithDarkStyle(dark), DarkBackgroundFallback(true)).classes(light, dark)
+	assert.Contains(t, classes[chroma.GenericInserted], "bg-[#ddffdd] dark:bg-[#191919]")
+}
+
+func TestWhitespace(t *testing.T) {
+	assert.HasPrefix(t, format(t, "x  y", InlineCode(true)), `<code class="whitespace-pre bg-[#f7f7f7]`)
+	assert.HasPrefix(t, format(t, "x  y", InlineCode(true), WrapLongLines(true)), `<code class="whitespace-pre-wrap break-words bg-[#f7f7f7]`)
+	// Without a <pre>, the code is wrapped in an element preserving whitespace.
+	out := format(t, "x  y", PreventSurroundingPre(true), ClassPrefix("tw-"))
+	assert.HasPrefix(t, out, `<span class="tw-whitespace-pre"><span class="tw-text-[#1f2328]">x</span>`)
+	assert.HasSuffix(t, out, "</span></span>")
+	assert.HasPrefix(t, format(t, "x  y", PreventSurroundingPre(true), Whitespace("whitespace-break-spaces")), `<span class="whitespace-break-spaces"><span`)
+	assert.False(t, strings.HasPrefix(format(t, "x  y", PreventSurroundingPre(true), WrapLongLines(true)), `<span class="whitespace`))
+	assert.HasPrefix(t, format(t, "x  y", Whitespace("whitespace-break-spaces")), `<pre class="whitespace-break-spaces bg-[#f7f7f7]`)
+	assert.NotContains(t, format(t, "x  y"), "whitespace-")
+}
+
+func TestHighlightAccent(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	highlight := HighlightLines([][2]int{{2, 2}})
+	out := format(t, source, highlight, HighlightAccent("border-[#f00]"), ClassPrefix("tw-"))
+	assert.Equal(t, 1, strings.Count(out, "tw-border-l-4 tw-border-[#f00]"))
+	assert.Contains(t, out, "tw-border-l-4 tw-border-[#f00]\"><span class=\"tw-grow tw-min-h-[1lh]\"><span")
+
+	out = format(t, source, highlight, HighlightAccent("border-[#f00]"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Equal(t, 1, strings.Count(out, "border-l-4 border-[#f00]"))
+	assert.Contains(t, out, "border-l-4 border-[#f00]\"><span class=\"whitespace-pre")
+	assert.NotContains(t, format(t, source, highlight), "border-l-4")
+}
+
+func TestInlineCodeBare(t *testing.T) {
+	out := format(t, "x  := 1", InlineCodeBare(true))
+	assert.NotContains(t, out, "<code")
+	assert.HasPrefix(t, out, `<span class="whitespace-pre bg-[#f7f7f7]"><span class="text-[#1f2328]`)
+	assert.Contains(t, out, `<span class="text-[#0550ae]">:=</span>`)
+	assert.HasSuffix(t, out, "</span></span>")
+}
+
+func TestAccessibleLabel(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, Accessible(true))
+	assert.Contains(t, out, `<pre class="bg-[#f7f7f7]" role="region" aria-label="Code block, 3 lines"><code>`)
+
+	out = format(t, source, Accessible(true), WithLanguage("Go"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<div class="bg-[#f7f7f7]" role="region" aria-label="Go code block, 3 lines">`)
+	assert.Equal(t, 1, strings.Count(out, "aria-label"))
+
+	assert.Contains(t, format(t, "x", Accessible(true)), `aria-label="Code block, 1 line"`)
+	assert.NotContains(t, format(t, source), "aria-label")
+}
+
+func TestInsertWordBreaks(t *testing.T) {
+	out := format(t, "x := aVeryLongIdentifierThatNeverEndsAtAll.field + \"a/b&c\"\n", InsertWordBreaks(true))
+	assert.Contains(t, out, "aVeryLongIdentifierT<wbr>hatNeverEndsAtAll")
+	assert.Contains(t, out, ">:=</span>")
+	assert.Contains(t, out, "&#34;a/<wbr>b&amp;c&#34;")
+	assert.NotContains(t, format(t, "x := aVeryLongIdentifierThatNeverEndsAtAll.field\n"), "<wbr>")
+}
+
+func TestLanguageContainerClass(t *testing.T) {
+	out := format(t, "package main\n", WithLanguage("Go"), LanguageContainerClass(true), ClassPrefix("tw-"))
+	assert.HasPrefix(t, out, `<pre class="tw-bg-[#f7f7f7] lang-go">`)
+	assert.NotContains(t, format(t, "package main\n", WithLanguage("Go")), "lang-")
+}
+
+func TestMetaColumn(t *testing.T) {
+	meta := func(line int) string { return fmt.Sprintf("<author%d>", line) }
+	out := format(t, "package main\n\nfunc main() {}\n", WithMetaColumn(meta), WithLineNumbers(true), LineNumbersInTable(true), HighlightLines([][2]int{{2, 2}}))
+	columns := strings.Split(out, "<td")
+	assert.Equal(t, 4, len(columns))
+	assert.Contains(t, columns[1], "&lt;author1&gt;\n</span>")
+	assert.Contains(t, columns[1], "&lt;author3&gt;\n</span>")
+	assert.Contains(t, columns[1], "bg-[#dedede]\"><span class=\"whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]\">&lt;author2&gt;\n</span></span>")
+	assert.Contains(t, columns[2], ">1\n</span>")
+	assert.NotContains(t, format(t, "x\n", WithMetaColumn(meta), WithLineNumbers(true)), "author")
+}
+
+func TestCodeClasses(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	formatter := New(PreventSurroundingPre(true), WithDarkStyle(dark))
+	it, err := lexers.Get("go").Tokenise(nil, "package main\n")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, formatter.Format(&buf, light, it))
+	assert.NotContains(t, buf.String(), "bg-[#f7f7f7]")
+	assert.Equal(t, "whitespace-pre bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117]", formatter.CodeClasses(light, dark))
+}
+
+func TestClasses(t *testing.T) {
+	light := styles.Get("github")
+	dark := styles.Get("github-dark")
+	formatter := New(WithDarkStyle(dark))
+	classes := formatter.Classes(light, dark)
+	assert.Equal(t, "text-[#cf222e] dark:text-[#ff7b72]", classes[chroma.Keyword])
+	assert.Equal(t, formatter.CodeClasses(light, dark), classes[chroma.PreWrapper])
+
+	// The cached map is unaffected by changes to the copy.
+	classes[chroma.Keyword] = "text-red-500"
+	assert.Equal(t, "text-[#cf222e] dark:text-[#ff7b72]", formatter.Classes(light, dark)[chroma.Keyword])
+}
+
+func TestPreventSurroundingPreLineNumbers(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, PreventSurroundingPre(true), WithLineNumbers(true), WithLinkableLineNumbers(true, "L"))
+	assert.HasPrefix(t, out, `<span class="whitespace-pre"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]" id="L1"><a class="outline-none no-underline text-[inherit]" href="#L1">1</a></span><span class="text-[#cf222e]">package</span>`)
+	assert.Contains(t, out, "\n"+`</span><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]" id="L2"><a class="outline-none no-underline text-[inherit]" href="#L2">2</a></span><span class="text-[#ffffff]">`)
+	assert.Equal(t, 3, strings.Count(out, "select-none"))
+	assert.HasSuffix(t, out, "\n</span></span>")
+	assert.NotContains(t, out, "<pre")
+	assert.NotContains(t, out, "flex")
+
+	assert.NotContains(t, format(t, source, PreventSurroundingPre(true)), "select-none")
+}
+
+func TestHighlightDataAttribute(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source, HighlightDataAttribute(true), HighlightLines([][2]int{{4, 4}, {1, 2}}))
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	assert.Contains(t, lines[0], `data-highlighted="true" data-highlight-range="0"`)
+	assert.Contains(t, lines[1], `data-highlighted="true" data-highlight-range="0"`)
+	assert.NotContains(t, lines[2], "data-highlight")
+	assert.Contains(t, lines[3], `data-highlighted="true" data-highlight-range="1"`)
+	assert.NotContains(t, format(t, source, HighlightLines([][2]int{{1, 2}})), "data-highlight")
+
+	// The gutter entries are marked alongside the highlight classes.
+	out = format(t, source, HighlightDataAttribute(true), HighlightLines([][2]int{{4, 4}}), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<span class="bg-[#dedede]" data-highlighted="true" data-highlight-range="0"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">4`)
+	assert.Equal(t, 2, strings.Count(out, "data-highlighted"))
+}
+
+func TestLineDataAttribute(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source, LineDataAttribute(true), BaseLineNumber(10))
+	assert.Contains(t, out, `<span class="flex" data-line="10"><span class="grow">`)
+	assert.Contains(t, out, `<span class="flex" data-line="13">`)
+	assert.Equal(t, 4, strings.Count(out, "data-line="))
+
+	// Alongside the id of linkable line numbers, in both columns of a table.
+	out = format(t, source, LineDataAttribute(true), WithLineNumbers(true), WithLinkableLineNumbers(true, "L"), LineNumbersInTable(true))
+	assert.Contains(t, out, `id="L2" data-line="2">`)
+	assert.Equal(t, 8, strings.Count(out, "data-line="))
+	assert.NotContains(t, out, `data-line="5"`)
+
+	// Plain output keeps its line elements.
+	out = format(t, source, LineDataAttribute(true), MinimalPlainOutput(true), FlatLines(true))
+	assert.Contains(t, out, `<span data-line="1">`)
+
+	assert.NotContains(t, format(t, source, WithLineNumbers(true)), "data-line")
+}
+
+func TestHighlightGroup(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source,
+		HighlightGroup("error", [][2]int{{1, 2}}, "bg-red-100"),
+		HighlightGroup("warning", [][2]int{{2, 3}}, "bg-amber-100"),
+	)
+	assert.Contains(t, out, `<pre class="grid `)
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	assert.HasPrefix(t, lines[0], ` col-span-full bg-red-100">`)
+	assert.HasPrefix(t, lines[1], ` col-span-full bg-amber-100">`)
+	assert.HasPrefix(t, lines[2], ` col-span-full bg-amber-100">`)
+	assert.HasPrefix(t, lines[3], ` col-span-full">`)
+
+	out = format(t, source,
+		HighlightGroup("added", [][2]int{{1, 1}}, "bg-green-100"),
+		HighlightGroup("changed", [][2]int{{3, 3}}, "bg-yellow-100"),
+		HighlightLines([][2]int{{3, 3}}),
+		WithLineNumbers(true), LineNumbersInTable(true),
+	)
+	gutter := out[:strings.Index(out, "</td>")]
+	assert.Contains(t, gutter, `<span class="bg-green-100"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">1`)
+	assert.Contains(t, gutter, `<span class="bg-[#dedede] bg-yellow-100"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">3`)
+	assert.Equal(t, 2, strings.Count(gutter, "</span></span>"))
+}
+
+func TestSparseStyle(t *testing.T) {
+	light := chroma.MustNewStyle("sparse", chroma.StyleEntries{chroma.Keyword: "bold #0000ff"})
+	dark := chroma.MustNewStyle("sparse-dark", chroma.StyleEntries{chroma.Background: "bg:#000000", chroma.Keyword: "#ff0000"})
+	classes := New().classes(light, dark)
+	assert.Equal(t, "text-[#0000ff] font-bold dark:text-[#ff0000] dark:font-normal", classes[chroma.Keyword])
+	for _, tt := range []chroma.TokenType{chroma.Name, chroma.NameFunction, chroma.LiteralString, chroma.Comment, chroma.Operator, chroma.Text} {
+		assert.Equal(t, "", classes[tt], "%s", tt)
+	}
+}
+
+func TestWithWrapperTag(t *testing.T) {
+	out := format(t, "package main\n", WithWrapperTag("div", "code"))
+	assert.HasPrefix(t, out, `<div class="whitespace-pre `)
+	assert.Contains(t, out, `"><code><span`)
+	assert.HasSuffix(t, out, "</code></div>")
+	assert.NotContains(t, out, "<pre")
+
+	out = format(t, "package main\n", WithWrapperTag("code-block", ""))
+	assert.HasPrefix(t, out, `<code-block class="`)
+	assert.HasSuffix(t, out, "</code-block>")
+	assert.NotContains(t, out, "<code>")
+
+	assert.Panics(t, func() { WithWrapperTag(`pre onclick="x"`, "code") })
+	assert.Panics(t, func() { WithWrapperTag("pre", "code>") })
+}
+
+func TestTokenTitles(t *testing.T) {
+	source := "package main\n\nfunc f() { return }\n"
+	out := format(t, source, TokenTitles(true))
+	assert.Contains(t, out, `<span class="text-[#cf222e]" title="Keyword">return</span>`)
+	assert.Contains(t, out, `<span class="text-[#cf222e]" title="KeywordNamespace">package</span>`)
+
+	out = format(t, source, TokenTitles(true), OmitPlainSpans(true))
+	assert.Contains(t, out, `<span title="TextWhitespace"> </span>`)
+}
+
+func TestWrapLines(t *testing.T) {
+	source := "package main\n\n// banner\nfunc main() {}\n"
+	out := format(t, source, WrapLongLines(true), WrapLines([][2]int{{3, 3}}))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7]`)
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	for i, line := range lines {
+		if i == 2 {
+			assert.HasPrefix(t, line, ` whitespace-pre-wrap break-words">`)
+		} else {
+			assert.HasPrefix(t, line, `">`)
+		}
+	}
+}
+
+func TestWrapIndent(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, WrapLongLines(true), WrapIndent("4ch"), WithLineNumbers(true))
+	assert.Contains(t, out, `<span class="flex"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">1</span><span class="grow pl-[4ch] -indent-[4ch]">`)
+	assert.Contains(t, out, `<span class="grow pl-[4ch] -indent-[4ch] min-h-[1lh]">`)
+
+	out = format(t, source, WrapLines([][2]int{{3, 3}}), WrapIndent("2em"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Equal(t, 3, strings.Count(out, `<span class="grow pl-[2em] -indent-[2em]`))
+
+	// Only wrapped code is indented.
+	assert.Equal(t, format(t, source), format(t, source, WrapIndent("4ch")))
+}
+
+func TestContentVisibilityAuto(t *testing.T) {
+	out := format(t, "package main\n", ContentVisibilityAuto(true))
+	assert.Contains(t, out, `<span class="flex [content-visibility:auto] [contain-intrinsic-size:auto_1lh]">`)
+
+	out = format(t, "package main\n")
+	assert.NotContains(t, out, "content-visibility")
+}
+
+func TestFormatLines(t *testing.T) {
+	it, err := lexers.Get("go").Tokenise(nil, "package main\n\nfunc main() {}\n")
+	assert.NoError(t, err)
+	lines := map[int]string{}
+	err = New(HighlightLines([][2]int{{3, 3}})).FormatLines(styles.Get("github"), it, func(line int, html string) error {
+		lines[line] = html
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, `<span class="flex col-span-full"><span class="grow min-h-[1lh]"><span class="text-[#ffffff]">`+"\n"+`</span></span></span>`, lines[2])
+	assert.HasPrefix(t, lines[3], `<span class="flex col-span-full bg-[#dedede]`)
+	assert.Contains(t, lines[3], `>main</span>`)
+	assert.NotContains(t, lines[1], "<pre")
+
+	it, err = lexers.Get("go").Tokenise(nil, "package main\n\nfunc main() {}\n")
+	assert.NoError(t, err)
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = New().FormatLines(styles.Get("github"), it, func(int, string) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFlagMixedIndent(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tx := 1\n \tx++\n    _ = x\n}\n"
+	out := format(t, source, FlagMixedIndent("bg-red-200"))
+	assert.Equal(t, 1, strings.Count(out, `<span class="bg-red-200">`))
+	lines := strings.Split(out, `<span class="flex">`)[1:]
+	assert.Contains(t, lines[4], `<span class="bg-red-200"><span class="text-[#ffffff]"> `+"\t"+`</span></span>`)
+
+	out = format(t, source)
+	assert.NotContains(t, out, "bg-red-200")
+}
+
+func TestSplitIndent(t *testing.T) {
+	indent, rest := splitIndent([]chroma.Token{{Type: chroma.Text, Value: " \tx"}, {Type: chroma.Text, Value: "y"}})
+	assert.Equal(t, []chroma.Token{{Type: chroma.Text, Value: " \t"}}, indent)
+	assert.Equal(t, []chroma.Token{{Type: chroma.Text, Value: "x"}, {Type: chroma.Text, Value: "y"}}, rest)
+	assert.True(t, isMixedIndent(indent))
+}
+
+func TestFocusTransition(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, FocusTransition("transition-[filter,opacity] duration-300"), HighlightLines([][2]int{{3, 3}}))
+	assert.Equal(t, 3, strings.Count(out, `<span class="flex col-span-full transition-[filter,opacity] duration-300`))
+
+	out = format(t, source, FocusTransition("transition-opacity"), ClassPrefix("tw-"))
+	assert.Equal(t, 3, strings.Count(out, `<span class="tw-flex tw-transition-opacity">`))
+}
+
+func TestNeutralDark(t *testing.T) {
+	source := "package main\n"
+	out := format(t, source, NeutralDark(true))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7] dark:bg-neutral-900">`)
+	assert.Contains(t, out, `<span class="text-[#cf222e] dark:text-[inherit]">package</span>`)
+
+	out = format(t, source, NeutralDark(true), NeutralDarkBackground("bg-black"))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7] dark:bg-black">`)
+
+	out = format(t, source, NeutralDark(true), WithDarkStyle(styles.Get("github-dark")))
+	assert.Contains(t, out, `<span class="text-[#cf222e] dark:text-[#ff7b72]">package</span>`)
+	assert.NotContains(t, out, "bg-neutral-900")
+}
+
+func TestNoDarkVariantsWithoutDarkStyle(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	assert.Equal(t, 0, strings.Count(format(t, source, WithLineNumbers(true), HighlightLines([][2]int{{3, 3}})), "dark:"))
+
+	out := format(t, source, WithDarkStyle(styles.Get("github-dark")))
+	assert.Contains(t, out, `<span class="text-[#cf222e] dark:text-[#ff7b72]">package</span>`)
+	assert.Contains(t, out, `<span class="text-[#1f2328] dark:text-[inherit]">main</span>`)
+}
+
+func TestDarkVariantsOnlyForDifferences(t *testing.T) {
+	for _, test := range []struct {
+		light, dark string
+		variants    int
+	}{
+		// Repeating the light values took 104, 76 and 75 variants.
+		{"github", "github-dark", 102},
+		{"gruvbox-light", "gruvbox", 54},
+		{"monokailight", "monokai", 50},
+	} {
+		classes := New().classes(styles.Get(test.light), styles.Get(test.dark))
+		variants := 0
+		for tt, cls := range classes {
+			fields := strings.Fields(cls)
+			for _, class := range fields {
+				if base, ok := strings.CutPrefix(class, "dark:"); ok {
+					variants++
+					assert.False(t, slices.Contains(fields, base), "%s: %s", tt, cls)
+				}
+			}
+		}
+		assert.Equal(t, test.variants, variants, test.dark)
+	}
+
+	light := chroma.MustNewStyle("light", chroma.StyleEntries{chroma.Keyword: "bold #ff0000", chroma.Name: "italic #00ff00"})
+	dark := chroma.MustNewStyle("dark", chroma.StyleEntries{chroma.Keyword: "bold #ff0000", chroma.Name: "#00ff00"})
+	classes := New().classes(light, dark)
+	assert.Equal(t, "text-[#ff0000] font-bold", classes[chroma.Keyword])
+	assert.Equal(t, "text-[#00ff00] italic dark:not-italic", classes[chroma.Name])
+}
+
+func TestPrintColors(t *testing.T) {
+	classes := New(PrintColors(true)).classes(styles.Get("github"), styles.Get("github-dark"))
+	assert.Equal(t, "bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117] print:text-[#000000] print:bg-transparent", classes[chroma.Background])
+	assert.Equal(t, "text-[#cf222e] dark:text-[#ff7b72] print:text-[#cf222e]", classes[chroma.Keyword])
+	assert.Equal(t, "text-[#116329] bg-[#dafbe1] dark:text-[#56d364] dark:bg-[#0f5323] print:text-[#116329] print:bg-transparent", classes[chroma.GenericInserted])
+
+	// Light colours of dark styles are darkened.
+	classes = New(PrintColors(true), ClassPrefix("tw-")).classes(styles.Get("monokai"), nil)
+	assert.Equal(t, "tw-text-[#f8f8f2] tw-bg-[#272822] print:tw-text-[#666664] print:tw-bg-transparent", classes[chroma.Background])
+
+	out := format(t, "package main\n", PrintColors(true))
+	assert.Contains(t, out, `<span class="text-[#cf222e] print:text-[#cf222e]">package</span>`)
+	assert.SliceContains(t, New(PrintColors(true)).ExtractClasses(styles.Get("github"), nil), "print:bg-transparent")
+	assert.NotContains(t, format(t, "package main\n", WithDarkStyle(styles.Get("github-dark"))), "print:")
+}
+
+func TestInlineCodeTheme(t *testing.T) {
+	out := format(t, "x := 1", InlineCode(true))
+	assert.HasPrefix(t, out, `<code class="whitespace-pre bg-[#f7f7f7] rounded px-1">`)
+
+	out = format(t, "x := 1", InlineCode(true), WithDarkStyle(styles.Get("github-dark")), InlinePadding("px-2 py-0.5"), InlineRounding(""))
+	assert.HasPrefix(t, out, `<code class="whitespace-pre bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117] px-2 py-0.5">`)
+}
+
+func TestShowWhitespace(t *testing.T) {
+	source := "package main\n"
+	out := format(t, source, ShowWhitespace("ws"))
+	assert.Contains(t, out, `<span class="text-[#ffffff] ws"> </span>`)
+	assert.Contains(t, out, `<span class="text-[#ffffff]">`+"\n</span>")
+
+	out = format(t, source, ShowWhitespace("ws"), OmitPlainSpans(true))
+	assert.Contains(t, out, `package</span><span class="ws"> </span>`)
+	assert.Contains(t, out, "main</span>\n")
+}
+
+func TestBlockLineNumbers(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, WithLineNumbers(true), LineNumbersInTable(true), BlockLineNumbers(true), HighlightLines([][2]int{{3, 3}}))
+	gutter := out[:strings.Index(out, "w-full")]
+	assert.Contains(t, gutter, `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f] block">1</span>`)
+	assert.Contains(t, gutter, `<span class="bg-[#dedede] block"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f] block">3</span></span>`)
+	assert.NotContains(t, gutter, "\n</span>")
+}
+
+func TestTrimTrailingNewline(t *testing.T) {
+	source := fmt.Sprintln("x := 1")
+	out := format(t, source, InlineCode(true))
+	assert.HasSuffix(t, out, `>1</span></code>`)
+	assert.NotContains(t, out, "\n")
+
+	out = format(t, "x\ny\n", InlineCode(true))
+	assert.Equal(t, 1, strings.Count(out, "\n"))
+
+	out = format(t, source, InlineCode(true), TrimTrailingNewline(false))
+	assert.HasSuffix(t, out, ">\n</span></code>")
+
+	out = format(t, source)
+	assert.HasSuffix(t, out, ">\n</span></span></span></code></pre>")
+	out = format(t, source, TrimTrailingNewline(true))
+	assert.HasSuffix(t, out, ">1</span></span></span></code></pre>")
+}
+
+// plainWriter hides the io.StringWriter implementation of its Writer.
+type plainWriter struct{ w *bytes.Buffer }
+
+func (p plainWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+
+func BenchmarkFormat(b *testing.B) {
+	source := strings.Repeat("package main\n\nfunc main() {\n\tprintln(`hello world`)\n}\n", 20)
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(b, err)
+	all := tokens.Tokens()
+	style := styles.Get("github")
+	formatter := New(WithLineNumbers(true))
+	var buf bytes.Buffer
+	b.Run("StringWriter", func(b *testing.B) {
+		for range b.N {
+			buf.Reset()
+			assert.NoError(b, formatter.Format(&buf, style, chroma.Literator(all...)))
+		}
+	})
+	b.Run("Writer", func(b *testing.B) {
+		for range b.N {
+			buf.Reset()
+			assert.NoError(b, formatter.Format(plainWriter{&buf}, style, chroma.Literator(all...)))
+		}
+	})
+}
+
+func TestDualLineNumbers(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	// Line 2 was removed and line 3 added.
+	mapping := func(line int) (int, int) {
+		switch line {
+		case 2:
+			return 2, 0
+		case 3:
+			return 0, 2
+		}
+		return 1, 1
+	}
+	out := format(t, source, WithLineNumbers(true), LineNumbersInTable(true), DualLineNumbers(10, 20, mapping))
+	gutters := strings.Split(out, "<td")[1:]
+	assert.Equal(t, 3, len(gutters))
+	number := `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">`
+	assert.Contains(t, gutters[0], number+"10\n</span>"+number+"11\n</span>"+number+"  \n</span>")
+	assert.Contains(t, gutters[1], number+"20\n</span>"+number+"  \n</span>"+number+"21\n</span>")
+	assert.Contains(t, gutters[2], "w-full")
+
+	// Inline, both numbers precede each line.
+	out = format(t, source, WithLineNumbers(true), DualLineNumbers(10, 20, mapping))
+	assert.Contains(t, out, `<span class="flex">`+number+"10</span>"+number+"20</span>"+`<span class="grow">`)
+	assert.Contains(t, out, `<span class="flex">`+number+"11</span>"+number+"  </span>"+`<span class="grow`)
+	assert.Contains(t, out, `<span class="flex">`+number+"  </span>"+number+"21</span>"+`<span class="grow">`)
+	assert.NotContains(t, out, "<td")
+}
+
+func TestLineLinkAttributes(t *testing.T) {
+	out := format(t, "package main\n", WithLineNumbers(true), WithLinkableLineNumbers(true, "L"), LineLinkRel("nofollow"), LineLinkTarget(`_top"`))
+	assert.Contains(t, out, `<a class="outline-none no-underline text-[inherit]" href="#L1" rel="nofollow" target="_top&#34;">1</a>`)
+
+	out = format(t, "package main\n", WithLineNumbers(true), WithLinkableLineNumbers(true, "L"))
+	assert.NotContains(t, out, "rel=")
+}
+
+func TestWithLineAnchors(t *testing.T) {
+	anchors := WithLineAnchors(func(line int) (string, string) {
+		id := fmt.Sprintf("file-main-go-L%d", line)
+		return id, "other.html#" + id
+	})
+	out := format(t, "package main\n", WithLineNumbers(true), anchors, HighlightLines([][2]int{{1, 1}}), WithHighlightTOC(true))
+	assert.Contains(t, out, `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]" id="file-main-go-L1"><a class="outline-none no-underline text-[inherit]" href="other.html#file-main-go-L1">1</a></span>`)
+	assert.Contains(t, out, `<li><a href="other.html#file-main-go-L1">`)
+}
+
+func TestFormatLine(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	options := []Option{WithLineNumbers(true), HighlightLines([][2]int{{10, 10}}), BaseLineNumber(8)}
+	it, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	tokens := it.Tokens()
+	formatter := New(options...)
+	full := format(t, source, options...)
+
+	for line := 8; line <= 10; line++ {
+		fragment, err := formatter.FormatLine(styles.Get("github"), tokens, line)
+		assert.NoError(t, err)
+		assert.Contains(t, full, fragment)
+		assert.Contains(t, fragment, fmt.Sprintf(">%2d</span>", line))
+	}
+	fragment, err := formatter.FormatLine(styles.Get("github"), tokens, 10)
+	assert.NoError(t, err)
+	assert.Contains(t, fragment, "bg-[#dedede]")
+
+	_, err = formatter.FormatLine(styles.Get("github"), tokens, 11)
+	assert.Error(t, err)
+}
+
+func TestFormatChunked(t *testing.T) {
+	source := strings.Repeat("x := 1\n", 7)
+	it, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	writer := bufio.NewWriterSize(&buf, 1<<16)
+	chunks := []int{}
+	lengths := []int{}
+	err = New().FormatChunked(writer, styles.Get("github"), it, 3, func(n int) error {
+		chunks = append(chunks, n)
+		lengths = append(lengths, buf.Len())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 6, 7}, chunks)
+	assert.Equal(t, format(t, source), buf.String())
+	assert.Equal(t, buf.Len(), lengths[2])
+	assert.True(t, lengths[0] > 0 && lengths[0] < lengths[1])
+	assert.Equal(t, 1, strings.Count(buf.String(), "<pre"))
+	assert.Equal(t, 1, strings.Count(buf.String(), "</pre>"))
+
+	it, err = lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	assert.Error(t, New().FormatChunked(io.Discard, styles.Get("github"), it, 0, nil))
+}
+
+func TestCodeColumnClass(t *testing.T) {
+	out := format(t, "package main\n", WithLineNumbers(true), LineNumbersInTable(true), CodeColumnClass("min-w-[40ch]"))
+	assert.Contains(t, out, `<td class="align-top p-0 m-0 border-0 min-w-[40ch]">`)
+	assert.NotContains(t, out, "w-full")
+
+	classes := New(WithLineNumbers(true), LineNumbersInTable(true), CodeColumnClass("min-w-[40ch]")).ExtractClasses(styles.Get("github"), nil)
+	assert.SliceContains(t, classes, "min-w-[40ch]")
+}
+
+func TestAssumeEscaped(t *testing.T) {
+	source := "s := \"a &lt; b\"\n"
+	assert.Contains(t, format(t, source), "&#34;a &amp;lt; b&#34;")
+
+	out := format(t, source, AssumeEscaped(true))
+	assert.Contains(t, out, `>"a &lt; b"</span>`)
+}
+
+func TestWithThemeName(t *testing.T) {
+	out := format(t, "package main\n", WithThemeName("github", `dark"er`))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7]" data-theme-light="github" data-theme-dark="dark&#34;er"><code>`)
+
+	out = format(t, "package main\n", WithThemeName("github", ""), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.HasPrefix(t, out, `<div class="bg-[#f7f7f7]" data-theme-light="github">`)
+	assert.Equal(t, 1, strings.Count(out, "data-theme-light"))
+}
+
+func TestCodePadding(t *testing.T) {
+	out := format(t, "package main\n", CodePadding("p-4"))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7] p-4"><code>`)
+
+	out = format(t, "package main\n", CodePadding("px-4"), WithLineNumbers(true), LineNumbersInTable(true))
+	gutter, code, ok := strings.Cut(out, "w-full")
+	assert.True(t, ok)
+	assert.NotContains(t, gutter, "px-4")
+	assert.Contains(t, code, `<pre class="bg-[#f7f7f7] px-4"><code>`)
+}
+
+func TestHighlightViaGridRows(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n\nvar x = 1\n"
+	out := format(t, source, HighlightViaGridRows(true), HighlightLines([][2]int{{2, 4}, {6, 6}}))
+	assert.NotContains(t, out, `<span class="flex col-span-full bg-`)
+	// The lines and the overlays are items of the same grid, which contains
+	// the overlays.
+	assert.HasPrefix(t, out, `<pre class="grid bg-[#f7f7f7]"><code><span class="grid relative isolate"><span class="flex col-span-full">`)
+	overlays := `<span class="bg-[#dedede] absolute inset-0 -z-10 pointer-events-none row-start-[2] row-end-[5]" aria-hidden="true"></span>` +
+		`<span class="bg-[#dedede] absolute inset-0 -z-10 pointer-events-none row-start-[6] row-end-[7]" aria-hidden="true"></span>`
+	assert.HasSuffix(t, out, "\n</span></span></span>"+overlays+"</span></code></pre>")
+	assert.Equal(t, 1, strings.Count(out, "relative"))
+
+	// Gap markers take up a row.
+	out = format(t, source, HighlightViaGridRows(true), HighlightLines([][2]int{{6, 6}}), LineWindows([][2]int{{1, 1}, {6, 6}}))
+	assert.Contains(t, out, `row-start-[3] row-end-[4]`)
+}
+
+func TestWithClassTransformer(t *testing.T) {
+	transformer := func(class string) string {
+		switch {
+		case class == "text-[#cf222e]":
+			return "text-keyword"
+		case strings.HasPrefix(class, "dark:"):
+			return ""
+		}
+		return class
+	}
+	out := format(t, "package main\n", WithClassTransformer(transformer))
+	assert.Contains(t, out, `<span class="text-keyword">package</span>`)
+	assert.NotContains(t, out, "dark:")
+
+	classes := New(WithClassTransformer(transformer)).ExtractClasses(styles.Get("github"), nil)
+	assert.SliceContains(t, classes, "text-keyword")
+	assert.False(t, strings.Contains(strings.Join(classes, " "), "#cf222e"))
+}
+
+func TestIndentationInFlexLines(t *testing.T) {
+	source := "func main() {\n\t  x()\n}\n"
+	out := format(t, source)
+	lines := strings.Split(out, `<span class="flex">`)[1:]
+	// The indentation is the first child of the code, inheriting whitespace-pre
+	// from the <pre> rather than being a flex item itself.
+	assert.HasPrefix(t, lines[1], `<span class="grow"><span class="text-[#ffffff]">`+"\t  "+`</span>`)
+	assert.HasPrefix(t, out, "<pre")
+
+	out = format(t, source, WithWrapperTag("div", ""))
+	assert.HasPrefix(t, out, `<div class="whitespace-pre `)
+}
+
+func TestWithHighlightTOC(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	options := []Option{WithLineNumbers(true), WithLinkableLineNumbers(true, "L"), HighlightLines([][2]int{{3, 4}, {1, 1}}), WithHighlightTOC(true)}
+	out := format(t, source, options...)
+	assert.HasPrefix(t, out, "<nav aria-label=\"Highlighted lines\"><ul>\n<li><a href=\"#L1\">Line 1</a></li>\n<li><a href=\"#L3\">Lines 3–4</a></li>\n</ul></nav>\n<pre")
+	assert.Contains(t, out, ` id="L3"`)
+
+	label := func(start, end int) string { return fmt.Sprintf("§%d", start) }
+	out = format(t, source, append(options, HighlightTOCClass("list-disc"), HighlightTOCLabel(label))...)
+	assert.HasPrefix(t, out, "<nav aria-label=\"Highlighted lines\"><ul class=\"list-disc\">\n<li><a href=\"#L1\">§1</a></li>")
+
+	out = format(t, source, WithLineNumbers(true), HighlightLines([][2]int{{3, 4}}), WithHighlightTOC(true))
+	assert.NotContains(t, out, "<nav")
+}
+
+func TestTokenPositionData(t *testing.T) {
+	source := "package main\n\nvar s = \"héllo\"\nvar x\n"
+	out := format(t, source, TokenPositionData(true), OmitPlainSpans(true))
+	start := strings.Index(source, `"héllo"`)
+	assert.Contains(t, out, fmt.Sprintf(`data-start="%d" data-end="%d">&#34;héllo&#34;</span>`, start, start+len(`"héllo"`)))
+	start = strings.LastIndex(source, "x")
+	assert.Contains(t, out, fmt.Sprintf(`data-start="%d" data-end="%d">x</span>`, start, start+1))
+	assert.Contains(t, out, `<span data-start="12" data-end="13">`+"\n</span>")
+
+	// Offsets count lines outside the rendered windows.
+	out = format(t, source, TokenPositionData(true), LineWindows([][2]int{{4, 4}}))
+	assert.Contains(t, out, fmt.Sprintf(`data-start="%d" data-end="%d">x</span>`, start, start+1))
+}
+
+func TestGapMarker(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source, LineWindows([][2]int{{1, 1}, {3, 4}}), GapMarker("…", "italic opacity-50"), WithLineNumbers(true))
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	assert.Contains(t, lines[0], ">package</span>")
+	assert.HasPrefix(t, lines[1], ` select-none italic opacity-50">…`+"\n</span>")
+	assert.Contains(t, lines[2], ">func</span>")
+	assert.NotContains(t, lines[1], "mr-[0.4em]")
+
+	out = format(t, source, LineWindows([][2]int{{1, 2}, {3, 4}}), GapMarker("…", ""))
+	assert.NotContains(t, out, "…")
+}
+
+func TestWithTokenElements(t *testing.T) {
+	source := "package main\n\n// Hi\nfunc main() {}\n"
+	out := format(t, source, WithTokenElements(map[chroma.TokenType]string{chroma.Comment: "em", chroma.NameFunction: "a"}), OmitPlainSpans(true))
+	assert.Contains(t, out, `<em class="text-[#57606a]">// Hi</em>`)
+	assert.Contains(t, out, `<a class="text-[#6639ba]">main</a>`)
+	assert.Contains(t, out, `<span class="text-[#cf222e]">func</span>`)
+
+	assert.Panics(t, func() { WithTokenElements(map[chroma.TokenType]string{chroma.Comment: "em onclick"}) })
+}
+
+func TestClassOrder(t *testing.T) {
+	options := []Option{WithLineNumbers(true), HighlightLines([][2]int{{1, 1}}), TabWidth(4)}
+	out := format(t, "package main\n", options...)
+	assert.HasPrefix(t, out, `<pre class="grid bg-[#f7f7f7] [tab-size:4]">`)
+	assert.Contains(t, out, `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">`)
+
+	out = format(t, "package main\n", append(options, ClassOrder(ClassOrderColourFirst))...)
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7] grid [tab-size:4]">`)
+	assert.Contains(t, out, `<span class="text-[#7f7f7f] whitespace-pre select-none mr-[0.4em] px-[0.4em]">`)
+
+	// Every group, in the documented order.
+	options = []Option{
+		WithDarkStyle(styles.Get("github-dark")), PrintColors(true),
+		DimTokens(chroma.LineNumbers, "opacity-50"),
+		WithCustomClasses(map[chroma.TokenType][]string{chroma.LineNumbers: {"tabular-nums"}}),
+	}
+	classes := New(options...).classes(styles.Get("github"), styles.Get("github-dark"))
+	assert.Equal(t, "whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f] dark:text-[#6e7681] print:text-[#666666] opacity-50 tabular-nums", classes[chroma.LineNumbers])
+	assert.Equal(t, "text-[#6639ba] dark:text-[#d2a8ff] dark:font-bold print:text-[#5a32a4]", classes[chroma.NameFunction])
+	classes = New(append(options, ClassOrder(ClassOrderColourFirst))...).classes(styles.Get("github"), styles.Get("github-dark"))
+	assert.Equal(t, "text-[#7f7f7f] dark:text-[#6e7681] print:text-[#666666] whitespace-pre select-none mr-[0.4em] px-[0.4em] opacity-50 tabular-nums", classes[chroma.LineNumbers])
+}
+
+func TestHighlightTokenFunc(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tioutil.ReadAll(r)\n}\n"
+	deprecated := func(token chroma.Token, line int) (string, bool) {
+		if token.Value == "ioutil" {
+			return "line-through decoration-red-500", true
+		}
+		return "", false
+	}
+	out := format(t, source, HighlightTokenFunc(deprecated))
+	assert.Equal(t, 1, strings.Count(out, "line-through"))
+	assert.Contains(t, out, `<span class="text-[#1f2328] line-through decoration-red-500">ioutil</span>`)
+
+	lines := []int{}
+	format(t, source, OmitPlainSpans(true), HighlightTokenFunc(func(token chroma.Token, line int) (string, bool) {
+		if token.Value == "main" {
+			lines = append(lines, line)
+		}
+		return "", false
+	}))
+	assert.Equal(t, []int{1, 3}, lines)
+}
+
+func TestIndentGuides(t *testing.T) {
+	source := "func main() {\n\tif x {\n\t    y()\n\n\t}\n}\n"
+	out := format(t, source, IndentGuides(true), TabWidth(4), OmitPlainSpans(true))
+	lines := strings.Split(out, `<span class="flex">`)[1:]
+	guide := `<span class="border-l border-gray-500/30 -ml-px">`
+	assert.Equal(t, 0, strings.Count(lines[0], guide))
+	code := `<span class="grow [tab-size:4]">`
+	assert.HasPrefix(t, lines[1], code+guide+"\t</span><span")
+	assert.HasPrefix(t, lines[2], code+guide+"\t</span>"+guide+"    </span><span")
+	assert.Equal(t, 0, strings.Count(lines[3], guide))
+	assert.Equal(t, 1, strings.Count(lines[4], guide))
+
+	// A partial level has no guide.
+	out = format(t, "  x\n", IndentGuides(true), TabWidth(4), OmitPlainSpans(true))
+	assert.NotContains(t, out, "border-l")
+}
+
+func TestHighlightLabel(t *testing.T) {
+	source := "package main\n\nfunc main() {\n}\n"
+	out := format(t, source,
+		Accessible(true),
+		HighlightLines([][2]int{{1, 1}}),
+		HighlightGroup("added", [][2]int{{3, 3}}, "bg-green-100"),
+		HighlightGroup("removed", [][2]int{{4, 4}}, "bg-red-100"),
+		HighlightLabel("removed", "deleted <line>"),
+	)
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	assert.Contains(t, lines[0], `<span class="sr-only select-none">highlighted: </span>`)
+	assert.NotContains(t, lines[1], "sr-only")
+	assert.Contains(t, lines[2], `<span class="sr-only select-none">added: </span>`)
+	assert.Contains(t, lines[3], `<span class="sr-only select-none">deleted &lt;line&gt;: </span>`)
+
+	assert.NotContains(t, format(t, source, HighlightLines([][2]int{{1, 1}})), "sr-only")
+	assert.Contains(t, format(t, source, Accessible(true), HighlightLines([][2]int{{1, 1}}), HighlightLabel("", "changed")), ">changed: </span>")
+}
+
+func TestSideAnnotations(t *testing.T) {
+	notes := map[int]string{1: "entry <point>", 3: "todo"}
+	out := format(t, "package main\n\nfunc main() {}\n", SideAnnotations(notes, "text-xs italic"), WithLineNumbers(true), LineNumbersInTable(true))
+	columns := strings.Split(out, "<td")
+	assert.Equal(t, 4, len(columns))
+	assert.NotContains(t, columns[2], "todo")
+	entries := strings.Split(columns[3], "<span class=\"whitespace-pre select-none")[1:]
+	assert.Equal(t, 3, len(entries))
+	assert.Contains(t, entries[0], `<span class="text-xs italic">entry &lt;point&gt;</span>`)
+	assert.Contains(t, entries[1], `[#7f7f7f]">`+"\n</span>")
+	assert.Contains(t, entries[2], `<span class="text-xs italic">todo</span>`)
+	assert.HasSuffix(t, out, "</td>\n</tr></table>\n</div>\n")
+
+	assert.NotContains(t, format(t, "x\n", SideAnnotations(notes, "")), "entry")
+}
+
+func TestBlankLineHeight(t *testing.T) {
+	out := format(t, "package main\n\nfunc main() {}\n")
+	lines := strings.Split(out, `<span class="flex">`)[1:]
+	assert.Equal(t, 3, len(lines))
+	assert.HasPrefix(t, lines[0], `<span class="grow"><span`)
+	assert.HasPrefix(t, lines[1], `<span class="grow min-h-[1lh]"><span`)
+	assert.HasPrefix(t, lines[2], `<span class="grow"><span`)
+}
+
+func TestStructuralClasses(t *testing.T) {
+	style := chroma.MustNewStyle("plain", chroma.StyleEntries{})
+	classes := New().classes(style, nil)
+	for tt, expected := range map[chroma.TokenType]string{
+		chroma.Background:       "",
+		chroma.PreWrapper:       "",
+		chroma.Line:             "flex",
+		chroma.CodeLine:         "grow",
+		chroma.LineNumbers:      "whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]",
+		chroma.LineNumbersTable: "whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]",
+		chroma.LineHighlight:    "bg-[#e5e5e5]",
+		chroma.LineTable:        "border-separate border-spacing-0 p-0 m-0 border-0",
+		chroma.LineTableTD:      "align-top p-0 m-0 border-0",
+		chroma.LineLink:         "outline-none no-underline text-[inherit]",
+		chroma.Error:            "",
+	} {
+		assert.Equal(t, expected, classes[tt], "%s", tt)
+	}
+	assert.Equal(t, "grid", New(HighlightLines([][2]int{{1, 1}})).classes(style, nil)[chroma.PreWrapper])
+}
+
+func TestPlainFallback(t *testing.T) {
+	source := "if a < b && c {\n}\n"
+	out := format(t, source, WithPlainFallback(true))
+	highlighted, fallback, ok := strings.Cut(out, "</pre>")
+	assert.True(t, ok)
+	assert.Contains(t, highlighted, `<span class="text-[#cf222e]">if</span>`)
+	assert.Equal(t, `<pre class="sr-only">if a &lt; b &amp;&amp; c {`+"\n}\n</pre>", fallback)
+
+	_, fallback, _ = strings.Cut(format(t, source, WithPlainFallback(true), WithLineNumbers(true), LineNumbersInTable(true)), "</div>\n")
+	assert.HasPrefix(t, fallback, `<pre class="sr-only">if a &lt; b`)
+	assert.NotContains(t, format(t, source), "sr-only")
+	assert.NotContains(t, format(t, source, WithPlainFallback(true), InlineCode(true)), "sr-only")
+}
+
+func TestWithTableClasses(t *testing.T) {
+	out := format(t, "package main\n", WithTableClasses("table-fixed border-collapse", "align-baseline"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<table class="table-fixed border-collapse">`)
+	assert.Equal(t, 2, strings.Count(out, `<td class="align-baseline`))
+	assert.Contains(t, out, `<td class="align-baseline w-full">`)
+	assert.NotContains(t, out, "border-separate")
+
+	out = format(t, "package main\n", WithTableClasses("", "align-baseline"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<table class="border-separate border-spacing-0 p-0 m-0 border-0">`)
+}
+
+func TestHighlightTokenTypes(t *testing.T) {
+	source := "func main() {\n\tfmt.Println(\"hi\")\n}\n\nfunc other() {}\n"
+	out := format(t, source, HighlightTokenTypes([]chroma.TokenType{chroma.NameFunction}, "underline"))
+	assert.Contains(t, out, `<span class="text-[#6639ba] underline">main</span>`)
+	assert.Contains(t, out, `<span class="text-[#6639ba] underline">other</span>`)
+	assert.Equal(t, 3, strings.Count(out, "underline"))
+
+	// Categories match their subtypes.
+	out = format(t, source, HighlightTokenTypes([]chroma.TokenType{chroma.LiteralString}, "underline"))
+	assert.Contains(t, out, `underline">&#34;hi&#34;</span>`)
+	assert.Equal(t, 1, strings.Count(out, "underline"))
+}
+
+func TestHighlightWhere(t *testing.T) {
+	source := "// TODO: a\nx := 1\n// TODO: b\n// TODO: c\n"
+	todo := func(tokens []chroma.Token) bool {
+		for _, token := range tokens {
+			if strings.Contains(token.Value, "TODO") {
+				return true
+			}
+		}
+		return false
+	}
+	out := format(t, source, HighlightWhere([][2]int{{2, 3}}, todo, "bg-yellow-100"))
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 4, len(lines))
+	assert.HasPrefix(t, lines[0], ` col-span-full">`)
+	assert.HasPrefix(t, lines[1], ` col-span-full">`)
+	assert.HasPrefix(t, lines[2], ` col-span-full bg-yellow-100">`)
+	assert.HasPrefix(t, lines[3], ` col-span-full">`)
+}
+
+func TestBoldClassAndSuppressEmphasis(t *testing.T) {
+	light := chroma.MustNewStyle("light", chroma.StyleEntries{
+		chroma.Keyword: "bold italic",
+		chroma.Comment: "underline",
+	})
+	dark := chroma.MustNewStyle("dark", chroma.StyleEntries{
+		chroma.Keyword: "#ffffff",
+		chroma.Comment: "bold",
+	})
+	classes := New(BoldClass("font-semibold"), ClassPrefix("tw-")).classes(light, dark)
+	assert.Equal(t, "tw-font-semibold tw-italic dark:tw-text-[#ffffff] dark:tw-font-normal dark:tw-not-italic", classes[chroma.Keyword])
+	assert.Equal(t, "tw-underline dark:tw-font-semibold dark:tw-no-underline", classes[chroma.Comment])
+
+	classes = New(BoldClass(""), SuppressEmphasis(true)).classes(light, dark)
+	assert.Equal(t, "dark:text-[#ffffff]", classes[chroma.Keyword])
+	assert.Equal(t, "", classes[chroma.Comment])
+
+	assert.Equal(t, "font-bold italic", New().classes(light, nil)[chroma.Keyword])
+}
+
+func TestDimComments(t *testing.T) {
+	source := "// hi\n/* there */\nx := 1\n"
+	out := format(t, source, DimComments(true))
+	assert.Contains(t, out, `<span class="text-[#57606a] opacity-70">// hi`)
+	assert.Contains(t, out, `<span class="text-[#57606a] opacity-70">/* there */</span>`)
+	assert.Equal(t, 2, strings.Count(out, "opacity-70"))
+	assert.NotContains(t, format(t, source), "opacity")
+
+	out = format(t, source, DimTokens(chroma.LiteralNumber, "opacity-50"), ClassPrefix("tw-"))
+	assert.Contains(t, out, `tw-opacity-50">1</span>`)
+	assert.Equal(t, 1, strings.Count(out, "opacity"))
+}
+
+func TestCompactGutter(t *testing.T) {
+	out := format(t, "package main\n", CompactGutter(true), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<span class="whitespace-pre select-none mr-[0.2em] px-[0.2em] text-[#7f7f7f]">1`)
+	assert.NotContains(t, out, "0.4em")
+
+	out = format(t, "package main\n", CompactGutter(true), WithLineNumbers(true))
+	assert.Contains(t, out, "mr-[0.4em] px-[0.4em]")
+	assert.NotContains(t, out, "0.2em")
+}
+
+func TestFormatWithText(t *testing.T) {
+	source := "package main\n\nfunc main() { x := \"<b>\" }\n"
+	it, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	plain, err := New().FormatWithText(&buf, styles.Get("github"), it)
+	assert.NoError(t, err)
+	assert.Equal(t, source, plain)
+	assert.Equal(t, format(t, source), buf.String())
+}
+
+func TestShrinkCodeColumn(t *testing.T) {
+	out := format(t, "package main\n", ShrinkCodeColumn(true), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, "<td class=\"align-top p-0 m-0 border-0\">\n<pre")
+	assert.NotContains(t, out, "w-full")
+	assert.SliceContains(t, New(WithLineNumbers(true), LineNumbersInTable(true)).ExtractClasses(styles.Get("github"), nil), "w-full")
+	assert.False(t, slices.Contains(New(ShrinkCodeColumn(true), WithLineNumbers(true), LineNumbersInTable(true)).ExtractClasses(styles.Get("github"), nil), "w-full"))
+}
+
+func TestHighlightLinesToEnd(t *testing.T) {
+	source := strings.Repeat("x := 1\n", 15)
+	for _, end := range []int{-1, 0} {
+		out := format(t, source, HighlightLines([][2]int{{10, end}}), WithLineNumbers(true))
+		lines := strings.Split(out, `<span class="flex`)[1:]
+		assert.Equal(t, 15, len(lines))
+		for i, line := range lines {
+			assert.Equal(t, i+1 >= 10, strings.Contains(line, "bg-[#dedede]"), "line %d", i+1)
+		}
+	}
+
+	out := format(t, source, HighlightLines([][2]int{{14, -1}}), WithLineNumbers(true), WithLinkableLineNumbers(true, "L"), WithHighlightTOC(true))
+	assert.Contains(t, out, ">Lines 14–15</a>")
+}
+
+func TestStandaloneBodyClass(t *testing.T) {
+	out := format(t, "package main\n", Standalone(true), StandaloneBodyClass("p-8 font-mono"), ClassPrefix("tw-"))
+	assert.Contains(t, out, "<body class=\"tw-bg-[#f7f7f7] tw-p-8 tw-font-mono\">\n")
+	assert.NotContains(t, format(t, "package main\n", StandaloneBodyClass("p-8")), "p-8")
+}
+
+func TestStandaloneHead(t *testing.T) {
+	out := format(t, "package main\n", Standalone(true))
+	assert.HasPrefix(t, out, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n</head>\n<body class=\"bg-[#f7f7f7]\">\n<pre")
+
+	out = format(t, "package main\n", Standalone(true), StandaloneTitle("a < b"), StandaloneLang("pt-BR"), StandaloneHead(`<link rel="stylesheet" href="site.css">`))
+	assert.HasPrefix(t, out, "<!DOCTYPE html>\n<html lang=\"pt-BR\">\n<head>\n<meta charset=\"utf-8\">\n<title>a &lt; b</title>\n<link rel=\"stylesheet\" href=\"site.css\">\n</head>\n<body")
+}
+
+type dataPreWrapper struct{ PreWrapper }
+
+func (d dataPreWrapper) StartWithContext(code bool, classAttr string, ctx PreContext) string {
+	return fmt.Sprintf(`<pre%s data-lines="%d" data-lang="%s">`, classAttr, ctx.Lines, ctx.Language)
+}
+
+func TestPreWrapperWithContext(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, WithPreWrapper(dataPreWrapper{defaultPreWrapper}), WithLanguage("go"))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7]" data-lines="3" data-lang="go"><span class="flex">`)
+
+	out = format(t, source, WithPreWrapper(dataPreWrapper{defaultPreWrapper}), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Equal(t, 2, strings.Count(out, `data-lines="3" data-lang=""`))
+
+	// Wrappers without the context keep working.
+	out = format(t, source, WithPreWrapper(defaultPreWrapper), WithLanguage("go"))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7]"><code>`)
+}
+
+func TestFlatLines(t *testing.T) {
+	out := format(t, "package main\n\nfunc main() {}\n", FlatLines(true), WithLineNumbers(true), HighlightLines([][2]int{{3, 3}}))
+	assert.NotContains(t, out, "flex")
+	assert.NotContains(t, out, "grow")
+	lines := strings.Split(out, `<span class="col-span-full`)[1:]
+	assert.Equal(t, 3, len(lines))
+	assert.HasPrefix(t, lines[0], `"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">1</span><span class="text-[#cf222e]">package</span>`)
+	assert.HasSuffix(t, lines[0], "\n</span></span>")
+	assert.HasPrefix(t, lines[2], ` bg-[#dedede]"><span`)
+	assert.Contains(t, lines[2], `>3</span><span class="text-[#cf222e]">func</span>`)
+}
+
+func TestErrorTooltips(t *testing.T) {
+	source := "x := @\n"
+	out := format(t, source, ErrorTooltips(true))
+	assert.Contains(t, out, `<span class="text-[#f6f8fa] bg-[#82071e] underline decoration-wavy decoration-red-500" title="unexpected input">@</span>`)
+	assert.NotContains(t, format(t, source), "title=")
+
+	out = format(t, source, ErrorTooltips(true), ErrorTooltipText(`"@" is not Go`), TokenTitles(true))
+	assert.Contains(t, out, `decoration-red-500" title="&#34;@&#34; is not Go">@</span>`)
+	assert.Equal(t, 1, strings.Count(out, `is not Go`))
+}
+
+func TestHighlightAnchors(t *testing.T) {
+	source := strings.Repeat("x := 1\n", 6)
+	out := format(t, source, HighlightLines([][2]int{{5, 6}, {2, 3}}), HighlightAnchors("hl-"))
+	lines := strings.Split(out, `<span class="flex`)[1:]
+	assert.Equal(t, 6, len(lines))
+	assert.HasPrefix(t, lines[1], ` col-span-full bg-[#dedede] scroll-mt-4" id="hl-1">`)
+	assert.HasPrefix(t, lines[4], ` col-span-full bg-[#dedede] scroll-mt-4" id="hl-2">`)
+	assert.Equal(t, 2, strings.Count(out, ` id="hl-`))
+
+	out = format(t, source, HighlightLines([][2]int{{2, 3}}), HighlightAnchors("hl-"), HighlightAnchorClass("scroll-mt-20"))
+	assert.Contains(t, out, `scroll-mt-20" id="hl-1">`)
+	assert.NotContains(t, format(t, source, HighlightLines([][2]int{{2, 3}})), "id=")
+}
+
+func TestAsGroup(t *testing.T) {
+	out := format(t, "package main\n\nfunc main() {}\n", AsGroup(true), ClassPrefix("tw-"))
+	assert.HasPrefix(t, out, `<pre class="tw-group tw-bg-[#f7f7f7]"><code>`)
+	assert.Equal(t, 3, strings.Count(out, `<span class="tw-flex tw-group/line tw-peer">`))
+	assert.NotContains(t, format(t, "package main\n"), "group")
+}
+
+func TestRowAndOuterDivClass(t *testing.T) {
+	out := format(t, "package main\n", WithRowClass("border-b"), WithOuterDivClass("rounded-lg overflow-x-auto"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.HasPrefix(t, out, "<div class=\"bg-[#f7f7f7] rounded-lg overflow-x-auto\">\n")
+	assert.Contains(t, out, `<table class="border-separate border-spacing-0 p-0 m-0 border-0"><tr class="border-b"><td`)
+
+	out = format(t, "package main\n", WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `border-0"><tr><td`)
+}
+
+func TestMinimalPlainOutput(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	tags := regexp.MustCompile(`<[^>]*>`)
+	general := format(t, source)
+	out := format(t, source, MinimalPlainOutput(true))
+	assert.HasPrefix(t, out, `<pre class="bg-[#f7f7f7]"><code><span class="text-[#cf222e]">package</span>`)
+	assert.NotContains(t, out, "flex")
+	assert.NotContains(t, out, "grow")
+	assert.Equal(t, strings.Count(general, `<span class="text-`), strings.Count(out, `<span class="text-`))
+	assert.Equal(t, tags.ReplaceAllString(general, ""), tags.ReplaceAllString(out, ""))
+
+	assert.Contains(t, format(t, source, MinimalPlainOutput(true), WithLineNumbers(true)), `<span class="flex">`)
+	assert.Contains(t, format(t, source, MinimalPlainOutput(true), HighlightLines([][2]int{{1, 1}})), `<span class="flex col-span-full`)
+}
+
+func TestMinimalPlainOutputFlatLines(t *testing.T) {
+	source := "a\nb\nc\n"
+	out := format(t, source, MinimalPlainOutput(true), FlatLines(true), WrapLines([][2]int{{2, 2}}))
+	assert.Equal(t, `<pre class="bg-[#f7f7f7]"><code><span class="text-[#1f2328]">a</span><span class="text-[#ffffff]">`+"\n"+`</span>`+
+		`<span class="whitespace-pre-wrap break-words"><span class="text-[#1f2328]">b</span><span class="text-[#ffffff]">`+"\n"+`</span></span>`+
+		`<span class="text-[#1f2328]">c</span><span class="text-[#ffffff]">`+"\n"+`</span></code></pre>`, out)
+
+	// Each line keeps its element while it has line numbers or highlights.
+	assert.Equal(t, 3, strings.Count(format(t, source, MinimalPlainOutput(true), FlatLines(true), WrapLines([][2]int{{2, 2}}), WithLineNumbers(true)), "select-none"))
+	assert.Equal(t, 3, strings.Count(format(t, source, MinimalPlainOutput(true), FlatLines(true), HighlightLines([][2]int{{2, 2}})), "col-span-full"))
+	assert.Equal(t, 3, strings.Count(format(t, source, FlatLines(true), WrapLines([][2]int{{2, 2}})), "</span></span>"))
+}
+
+func BenchmarkMinimalPlainOutput(b *testing.B) {
+	source := strings.Repeat("package main\n\nfunc main() {\n\tprintln(`hello world`)\n}\n", 20)
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(b, err)
+	all := tokens.Tokens()
+	style := styles.Get("github")
+	var buf bytes.Buffer
+	for _, bench := range []struct {
+		name      string
+		formatter *Formatter
+	}{
+		{"General", New()},
+		{"Minimal", New(MinimalPlainOutput(true))},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				buf.Reset()
+				assert.NoError(b, bench.formatter.Format(&buf, style, chroma.Literator(all...)))
+			}
+			b.SetBytes(int64(buf.Len()))
+		})
+	}
+}
+
+func TestNoInheritResetsColour(t *testing.T) {
+	style := chroma.MustNewStyle("wrapped", chroma.StyleEntries{
+		chroma.Background: "#111111 bg:#ffffff",
+		chroma.CodeLine:   "#ff0000",
+		chroma.Keyword:    "noinherit italic",
+		chroma.Name:       "noinherit #00ff00",
+		chroma.Comment:    "italic",
+	})
+	dark := chroma.MustNewStyle("wrapped-dark", chroma.StyleEntries{
+		chroma.Background: "#eeeeee bg:#000000",
+		chroma.CodeLine:   "#ff0000",
+		chroma.Keyword:    "noinherit",
+	})
+	classes := New().classes(style, nil)
+	// The keyword would otherwise take the colour of the CodeLine.
+	assert.Equal(t, "text-[#111111] italic", classes[chroma.Keyword])
+	assert.Equal(t, "text-[#00ff00]", classes[chroma.Name])
+	assert.Equal(t, "italic", classes[chroma.Comment])
+
+	classes = New(WithDarkStyle(dark)).classes(style, dark)
+	assert.Equal(t, "text-[#111111] italic dark:text-[#eeeeee] dark:not-italic", classes[chroma.Keyword])
+
+	// Nothing is reset without a differing wrapper colour.
+	style = chroma.MustNewStyle("plain", chroma.StyleEntries{chroma.Background: "#111111 bg:#ffffff", chroma.Keyword: "noinherit italic"})
+	assert.Equal(t, "italic", New().classes(style, nil)[chroma.Keyword])
+}
+
+func TestWithCustomClasses(t *testing.T) {
+	custom := map[chroma.TokenType][]string{
+		chroma.Keyword:            {"underline decoration-dotted"},
+		chroma.KeywordDeclaration: {"font-mono"},
+		chroma.Background:         {"rounded-lg"},
+		chroma.PreWrapper:         {"overflow-x-auto"},
+	}
+	out := format(t, "package main\n\nfunc main() {}\n", WithCustomClasses(custom), ClassPrefix("tw-"))
+	assert.HasPrefix(t, out, `<pre class="tw-overflow-x-auto tw-bg-[#f7f7f7] tw-rounded-lg"><code>`)
+	assert.Contains(t, out, `<span class="tw-text-[#cf222e] tw-underline tw-decoration-dotted">package</span>`)
+	assert.Contains(t, out, `<span class="tw-text-[#cf222e] tw-font-mono">func</span>`)
+	assert.NotContains(t, format(t, "package main\n"), "decoration-dotted")
+}
+
+func TestDarkModeStrategy(t *testing.T) {
+	dark := WithDarkStyle(styles.Get("github-dark"))
+	out := format(t, "package main\n", dark, DarkModeStrategy(DarkModeMedia), ClassPrefix("tw-"))
+	assert.HasPrefix(t, out, `<pre class="tw-bg-[#f7f7f7] [@media(prefers-color-scheme:dark)]:tw-text-[#e6edf3] [@media(prefers-color-scheme:dark)]:tw-bg-[#0d1117]">`)
+	assert.Contains(t, out, `<span class="tw-text-[#cf222e] [@media(prefers-color-scheme:dark)]:tw-text-[#ff7b72]">package</span>`)
+	assert.NotContains(t, out, "dark:")
+
+	out = format(t, "package main\n", dark, DarkModeStrategy(DarkModeClass))
+	assert.Equal(t, format(t, "package main\n", dark), out)
+	assert.Contains(t, out, `dark:text-[#ff7b72]`)
+}
+
+func TestMergeAdjacentTokens(t *testing.T) {
+	source := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tx := []int{1, 2, 3}\n\tfmt.Println(x[0] < 2 && x[1] > 1)\n}\n"
+	tags := regexp.MustCompile(`<[^>]*>`)
+	general := format(t, source, MergeAdjacentTokens(false))
+	out := format(t, source)
+	assert.Equal(t, out, format(t, source, MergeAdjacentTokens(true)))
+	assert.Equal(t, 64, strings.Count(general, "<span class=\"text-"))
+	assert.Equal(t, 58, strings.Count(out, "<span class=\"text-"))
+	assert.Equal(t, tags.ReplaceAllString(general, ""), tags.ReplaceAllString(out, ""))
+	assert.Contains(t, out, `<span class="text-[#1f2328]">()</span>`)
+	assert.Contains(t, out, `<span class="text-[#1f2328]">(x[</span>`)
+	assert.Contains(t, out, `<span class="text-[#0550ae]">&amp;&amp;</span>`)
+
+	// Tokens with differing attributes are not merged.
+	out = format(t, source, TokenPositionData(true))
+	assert.Equal(t, 64, strings.Count(out, "<span class=\"text-"))
+}
+
+// failingWriter fails once more than n bytes have been written.
+type failingWriter struct {
+	n       int
+	written int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (f *failingWriter) Write(b []byte) (int, error) {
+	if f.written+len(b) > f.n {
+		return 0, errWriteFailed
+	}
+	f.written += len(b)
+	return len(b), nil
+}
+
+func TestFormatWriteError(t *testing.T) {
+	source := strings.Repeat("package main\n", 100)
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	all := tokens.Tokens()
+	style := styles.Get("github")
+	for _, options := range [][]Option{nil, {WithLineNumbers(true)}, {Standalone(true)}} {
+		w := &failingWriter{n: 1000}
+		err := New(options...).Format(w, style, chroma.Literator(all...))
+		assert.IsError(t, err, errWriteFailed)
+		assert.True(t, w.written <= 1000)
+	}
+	w := &failingWriter{n: 1000}
+	err = New(Standalone(true)).FormatMulti(w, style, []Block{{Tokens: all}})
+	assert.IsError(t, err, errWriteFailed)
+}
+
+func TestFormatContext(t *testing.T) {
+	source := strings.Repeat("package main\n", 1000)
+	tokens, err := lexers.Get("go").Tokenise(nil, source)
+	assert.NoError(t, err)
+	all := tokens.Tokens()
+	style := styles.Get("github")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out strings.Builder
+	assert.NoError(t, New().FormatContext(ctx, &out, style, chroma.Literator(all...)))
+	assert.Equal(t, 1000, strings.Count(out.String(), "package"))
+
+	for _, options := range [][]Option{nil, {WithLineNumbers(true)}} {
+		calls := 0
+		ctx, cancel := context.WithCancel(context.Background())
+		// Cancel partway through the output.
+		w := writerFunc(func(p []byte) (int, error) {
+			if calls++; calls > 10 {
+				cancel()
+			}
+			return len(p), nil
+		})
+		err = New(options...).FormatContext(ctx, w, style, chroma.Literator(all...))
+		assert.IsError(t, err, context.Canceled)
+		assert.True(t, calls < 1000)
+	}
+
+	cancel()
+	out.Reset()
+	assert.IsError(t, New().FormatContext(ctx, &out, style, chroma.Literator(all...)), context.Canceled)
+	assert.Equal(t, "", out.String())
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) { return fn(p) }
+
+func TestMinify(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	options := []Option{WithLineNumbers(true), LineNumbersInTable(true), Standalone(true), StandaloneTitle("main.go")}
+	out := format(t, source, append(options, Minify(true))...)
+	assert.HasPrefix(t, out, `<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>main.go</title></head><body class="bg-[#f7f7f7]"><div role="region" aria-label="main.go"><div class="bg-[#f7f7f7]"><table`)
+	assert.HasSuffix(t, out, "</tr></table></div></div></body></html>")
+	assert.Contains(t, out, `<tr><td class="align-top p-0 m-0 border-0"><pre`)
+	// Only the newlines of the code and of the line numbers remain.
+	assert.Equal(t, 6, strings.Count(out, "\n"))
+
+	general := format(t, source, options...)
+	assert.Equal(t, strings.ReplaceAll(general, "\n", ""), strings.ReplaceAll(out, "\n", ""))
+	assert.Equal(t, general, format(t, source, append(options, Minify(false))...))
+}
+
+func TestLineNumbersAsList(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, WithLineNumbers(true), LineNumbersAsList(true), BaseLineNumber(10), HighlightLines([][2]int{{12, 12}}), WithLinkableLineNumbers(true, "L"))
+	assert.Contains(t, out, `<code><ol class="list-none m-0 p-0" role="list"><li class="flex col-span-full" value="10"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]" id="L10"><a class="outline-none no-underline text-[inherit]" href="#L10">10</a></span>`)
+	assert.Contains(t, out, `<li class="flex col-span-full bg-[#dedede]" value="12">`)
+	assert.Equal(t, 3, strings.Count(out, "</li>"))
+	assert.Contains(t, out, "</li></ol></code></pre>")
+
+	// Table mode keeps its own layout.
+	assert.NotContains(t, format(t, source, WithLineNumbers(true), LineNumbersInTable(true), LineNumbersAsList(true)), "<ol")
+	assert.NotContains(t, format(t, source, LineNumbersAsList(true)), "<ol")
+}
+
+func TestLineNumbersRight(t *testing.T) {
+	source := "package main\n"
+	out := format(t, source, WithLineNumbers(true), LineNumbersRight(true), WithLinkableLineNumbers(true, "L"))
+	assert.Contains(t, out, `<span class="text-[#1f2328]">main</span><span class="text-[#ffffff]">`+"\n"+`</span></span><span class="whitespace-pre select-none ml-[0.4em] px-[0.4em] text-[#7f7f7f]" id="L1"><a class="outline-none no-underline text-[inherit]" href="#L1">1</a></span></span></code></pre>`)
+	assert.NotContains(t, out, "mr-[0.4em]")
+
+	out = format(t, source, WithLineNumbers(true), LineNumbersInTable(true), LineNumbersRight(true))
+	assert.Contains(t, out, `</span></span></span></code></pre></td><td class="align-top p-0 m-0 border-0">`+"\n"+`<pre class="bg-[#f7f7f7]"><span class="whitespace-pre select-none ml-[0.4em] px-[0.4em] text-[#7f7f7f]">1`+"\n"+`</span></pre></td>`+"\n"+`</tr></table>`)
+	assert.Contains(t, out, `<tr><td class="align-top p-0 m-0 border-0 w-full">`)
+}
+
+func TestDimUnhighlighted(t *testing.T) {
+	source := "a\nb\nc\n"
+	out := format(t, source, DimUnhighlighted("opacity-50"), HighlightLines([][2]int{{2, 2}}), ClassPrefix("tw-"))
+	assert.Equal(t, 2, strings.Count(out, `<span class="tw-flex tw-col-span-full tw-opacity-50">`))
+	assert.Contains(t, out, `<span class="tw-flex tw-col-span-full tw-bg-[#dedede]">`)
+
+	out = format(t, source, DimUnhighlighted("opacity-50"), HighlightLines([][2]int{{2, 2}}), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.Contains(t, out, `<span class="opacity-50"><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">1`+"\n"+`</span></span>`)
+	assert.Equal(t, 4, strings.Count(out, `opacity-50`))
+
+	out = format(t, source, DimUnhighlighted("opacity-50"), HighlightGroup("intro", [][2]int{{1, 1}}, "bg-blue-100"))
+	assert.Equal(t, 2, strings.Count(out, "opacity-50"))
+
+	assert.NotContains(t, format(t, source, DimUnhighlighted("opacity-50")), "opacity-50")
+	assert.SliceContains(t, New(DimUnhighlighted("opacity-50"), HighlightLines([][2]int{{2, 2}})).ExtractClasses(styles.Get("github"), nil), "opacity-50")
+}
+
+func TestLineNumberStep(t *testing.T) {
+	source := strings.Repeat("x\n", 11)
+	out := format(t, source, WithLineNumbers(true), LineNumberStep(5), WithLinkableLineNumbers(true, "L"))
+	for _, line := range []int{1, 5, 10} {
+		assert.Contains(t, out, fmt.Sprintf(`id="L%d"><a class="outline-none no-underline text-[inherit]" href="#L%d">%2d</a></span>`, line, line, line))
+	}
+	assert.Equal(t, 3, strings.Count(out, "<a "))
+	assert.Contains(t, out, `<span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]" id="L2">  </span>`)
+	assert.Equal(t, 11, strings.Count(out, ` id="L`))
+
+	out = format(t, source, WithLineNumbers(true), LineNumbersInTable(true), LineNumberStep(5), BaseLineNumber(3))
+	assert.Contains(t, out, `text-[#7f7f7f]"> 3`+"\n"+`</span><span class="whitespace-pre select-none mr-[0.4em] px-[0.4em] text-[#7f7f7f]">  `+"\n"+`</span>`)
+	assert.Contains(t, out, `text-[#7f7f7f]"> 5`+"\n")
+	assert.NotContains(t, out, `text-[#7f7f7f]"> 4`)
+
+	assert.Equal(t, format(t, source, WithLineNumbers(true)), format(t, source, WithLineNumbers(true), LineNumberStep(1)))
+}
+
+func TestBackgroundAlpha(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	out := format(t, source, BackgroundAlpha(20), HighlightLines([][2]int{{1, 1}}), WithDarkStyle(styles.Get("github-dark")))
+	assert.Contains(t, out, `<span class="flex col-span-full bg-[#dedede]/20 dark:bg-[#6e7681]/20">`)
+	// The code background is unaffected.
+	assert.Contains(t, out, `<pre class="grid bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117]">`)
+
+	classes := New(BackgroundAlpha(35), ClassPrefix("tw-")).classes(styles.Get("github"), nil)
+	assert.Equal(t, "tw-text-[#116329] tw-bg-[#dafbe1]/35", classes[chroma.GenericInserted])
+	assert.Equal(t, "tw-text-[#82071e] tw-bg-[#ffebe9]/35", classes[chroma.GenericDeleted])
+
+	assert.Equal(t, format(t, source, HighlightLines([][2]int{{1, 1}})), format(t, source, BackgroundAlpha(100), HighlightLines([][2]int{{1, 1}})))
+}
+
+func TestWithCaption(t *testing.T) {
+	source := "package main\n"
+	out := format(t, source, WithCaption("main.go <1>"), WithDarkStyle(styles.Get("github-dark")))
+	assert.HasPrefix(t, out, `<figure><figcaption class="bg-[#f7f7f7] dark:text-[#e6edf3] dark:bg-[#0d1117] px-4 py-2 text-sm font-semibold">main.go &lt;1&gt;</figcaption><pre class="bg-[#f7f7f7]`)
+	assert.HasSuffix(t, out, "</code></pre></figure>")
+
+	out = format(t, source, WithCaption("Go"), CaptionClass("px-2"), WithLineNumbers(true), LineNumbersInTable(true))
+	assert.HasPrefix(t, out, `<figure><figcaption class="bg-[#f7f7f7] px-2">Go</figcaption><div class="bg-[#f7f7f7]">`)
+	assert.HasSuffix(t, out, "</tr></table>\n</div>\n</figure>")
+
+	assert.NotContains(t, format(t, source, WithCaption("Go"), Standalone(true)), "figure")
+	assert.NotContains(t, format(t, source, WithCaption("Go"), PreventSurroundingPre(true)), "figure")
+}
+
+func TestWithCopyButton(t *testing.T) {
+	source := "if a < b {\n}\n"
+	out := format(t, source, Standalone(true), WithCopyButton(true), WithNonce(`abc"123`), ClassPrefix("tw-"))
+	assert.Contains(t, out, `<div class="tw-relative"><button type="button" class="tw-absolute tw-top-2 tw-right-2 tw-px-2 tw-py-1 tw-text-xs tw-rounded tw-border tw-border-current tw-opacity-75" data-clipboard-text="if a &lt; b {`+"\n}\n"+`">Copy</button><pre`)
+	assert.Contains(t, out, "</code></pre></div>\n<script nonce=\"abc&#34;123\">document.addEventListener(")
+	assert.HasSuffix(t, out, "</script>\n</body>\n</html>\n")
+
+	out = format(t, source, Standalone(true), WithCopyButton(true))
+	assert.Contains(t, out, "<script>")
+
+	out = format(t, source, WithCopyButton(true))
+	assert.NotContains(t, out, "button")
+	assert.NotContains(t, out, "script")
+}
+
+func TestMergeWhitespace(t *testing.T) {
+	tokens := []chroma.Token{
+		{Type: chroma.TextWhitespace, Value: "\t"},
+		{Type: chroma.Text, Value: "  "},
+		{Type: chroma.Name, Value: "x"},
+		{Type: chroma.Text, Value: " "},
+		{Type: chroma.Operator, Value: " "},
+		{Type: chroma.Text, Value: " "},
+		{Type: chroma.TextWhitespace, Value: "\n"},
+	}
+	assert.Equal(t, []chroma.Token{
+		{Type: chroma.TextWhitespace, Value: "\t  "},
+		{Type: chroma.Name, Value: "x"},
+		{Type: chroma.Text, Value: " "},
+		{Type: chroma.Operator, Value: " "},
+		{Type: chroma.Text, Value: " \n"},
+	}, mergeWhitespace(tokens))
+	assert.Equal(t, "\t", tokens[0].Value)
+
+	source := "func main() {\n\tx := 1\n}\n"
+	tags := regexp.MustCompile(`<[^>]*>`)
+	out := format(t, source, MergeWhitespace(true), IndentClass("indent"))
+	assert.Equal(t, tags.ReplaceAllString(format(t, source), ""), tags.ReplaceAllString(out, ""))
+	assert.Contains(t, out, `<span class="grow"><span class="indent"><span class="text-[#ffffff]">`+"\t"+`</span></span><span class="text-[#1f2328]">x</span>`)
+	assert.Equal(t, 1, strings.Count(out, "indent"))
+
+	out = format(t, source, MergeWhitespace(true), IndentClass("indent"), ExpandTabs(true), TabWidth(2), ClassPrefix("tw-"))
+	assert.Contains(t, out, `<span class="tw-indent"><span class="tw-text-[#ffffff]">  </span></span>`)
+	assert.SliceContains(t, New(IndentClass("indent")).ExtractClasses(styles.Get("github"), nil), "indent")
+}
@@ -0,0 +1,37 @@
+package tailwind
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akfaew/chroma-tailwind/v2"
+)
+
+// WriteVariables writes a CSS rule for selector (eg. ".theme-github") defining
+// the token colour and background variables used with TokenColorVariables for
+// style. Token backgrounds matching the style background are omitted, as they
+// are in the classes.
+func (f *Formatter) WriteVariables(w io.Writer, selector string, style *chroma.Style) error {
+	if _, err := fmt.Fprintf(w, "%s {\n", selector); err != nil {
+		return err
+	}
+	bg := style.Get(chroma.Background)
+	for _, tt := range standardTypes() {
+		entry := style.Get(tt)
+		if tt != chroma.Background {
+			entry = entry.Sub(bg)
+		}
+		if entry.Colour.IsSet() {
+			if _, err := fmt.Fprintf(w, "  %s: %s;\n", tokenColorVariable(tt), f.colourString(entry.Colour)); err != nil {
+				return err
+			}
+		}
+		if entry.Background.IsSet() {
+			if _, err := fmt.Fprintf(w, "  %s: %s;\n", tokenBackgroundVariable(tt), f.colourString(entry.Background)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
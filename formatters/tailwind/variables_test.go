@@ -0,0 +1,30 @@
+package tailwind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/akfaew/chroma-tailwind/v2/styles"
+)
+
+func TestTokenColorVariables(t *testing.T) {
+	out := format(t, "package main\n", TokenColorVariables(true), WithDarkStyle(styles.Get("github-dark")))
+	assert.Contains(t, out, `<span class="text-[color:var(--t-kn)]">package</span>`)
+	assert.NotContains(t, out, "dark:text-")
+	assert.HasPrefix(t, out, `<pre class="text-[color:var(--t-bg)] bg-[color:var(--t-bg-bg)]"><code>`)
+	assert.NotContains(t, out, "dark:bg-")
+
+	var css bytes.Buffer
+	assert.NoError(t, New(TokenColorVariables(true)).WriteVariables(&css, ".theme-github", styles.Get("github")))
+	assert.HasPrefix(t, css.String(), ".theme-github {\n")
+	assert.Contains(t, css.String(), "  --t-kn: #cf222e;\n")
+	assert.Contains(t, css.String(), "  --t-bg-bg: #f7f7f7;\n")
+	assert.Contains(t, css.String(), "  --t-err: #f6f8fa;\n  --t-err-bg: #82071e;\n")
+	assert.HasSuffix(t, css.String(), "}\n")
+
+	css.Reset()
+	assert.NoError(t, New(TokenColorVariables(true)).WriteVariables(&css, ".dark", styles.Get("github-dark")))
+	assert.Contains(t, css.String(), "  --t-kn: #ff7b72;\n")
+}
@@ -215,3 +215,11 @@ func TestLexersTextAnalyser(t *testing.T) {
 		FileTestAnalysis(t, lexer, actualFilepath, expectedFilepath)
 	}
 }
+
+func TestHTMLDelegatesEmbeddedScript(t *testing.T) {
+	it, err := lexers.HTML.Tokenise(nil, "<script>var x = 1;</script>")
+	assert.NoError(t, err)
+	tokens := it.Tokens()
+	assert.SliceContains(t, tokens, chroma.Token{Type: chroma.KeywordDeclaration, Value: "var"})
+	assert.SliceContains(t, tokens, chroma.Token{Type: chroma.LiteralNumberInteger, Value: "1"})
+}